@@ -1,21 +1,43 @@
 package entity
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	uuid "github.com/satori/go.uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
+var localePattern = regexp.MustCompile("^[a-zA-Z]{2,3}([-_][a-zA-Z0-9]{2,8}){0,3}$")
+
+// AccountUnverified is the status of a self-registered account that has not yet verified its email
+const AccountUnverified = "unverified"
+
+// AccountAwaitingApproval is the status of a self-registered account that has verified its email and waits for an administrator to approve it
+const AccountAwaitingApproval = "awaiting-approval"
+
 // Account represents an account that can be used to access the system
 type Account struct {
-	ID                 string   `json:"id" gorm:"not null;unique;size:36" validate:"uuid4,required"`
-	Email              string   `json:"email" gorm:"not null;unique;size:100" validate:"email,required"`
-	Roles              []string `json:"roles" gorm:"-"`
-	RolesSerialized    string   `json:"-" gorm:"roles"`
-	PasswordResetToken string   `json:"-"`
-	Password           string   `json:"-"`
+	ID                  string     `json:"id" gorm:"not null;unique;size:36" validate:"uuid4,required"`
+	RealmID             string     `json:"-" gorm:"size:50;unique_index:idx_accounts_realm_email"`
+	Email               string     `json:"email" gorm:"not null;size:100;unique_index:idx_accounts_realm_email" validate:"email,required"`
+	EmailVerified       bool       `json:"emailVerified"`
+	Locale              string     `json:"locale,omitempty" gorm:"size:35" validate:"max=35"`
+	Status              string     `json:"status,omitempty" gorm:"size:20;index"`
+	VerificationToken   string     `json:"-" gorm:"size:64"`
+	Roles               []string   `json:"roles" gorm:"-"`
+	PasswordResetToken  string     `json:"-"`
+	LoginLinkToken      string     `json:"-" gorm:"size:64"`
+	Password            string     `json:"-"`
+	PasswordChangedAt   *time.Time `json:"passwordChangedAt,omitempty"`
+	MustChangePassword  bool       `json:"mustChangePassword"`
+	CreatedAt           *time.Time `json:"createdAt,omitempty" sql:"index"`
+	ExpiresAt           *time.Time `json:"expiresAt,omitempty" sql:"index"`
+	ExpiryWarningSentAt *time.Time `json:"-"`
+	DeletedAt           *time.Time `json:"deletedAt,omitempty" sql:"index"`
 }
 
 // AccountWithPassword represents an account but includes a seriaziable password property
@@ -45,36 +67,104 @@ func (account *Account) BeforeSave() {
 		account.ID = uuid.Must(uuid.NewV4()).String()
 	}
 
-	account.RolesSerialized = account.GetRolesSerialized()
+	if account.RealmID == "" {
+		account.RealmID = DefaultRealm
+	}
+}
+
+// AfterSave will run after the struct has been persisted with gorm and replaces the accounts role assignments
+func (account *Account) AfterSave(databaseConnection *gorm.DB) error {
+	return saveRoleNamesForAccount(databaseConnection, account.RealmID, account.ID, account.Roles)
 }
 
 // AfterFind will run after the struct has been read from persistence
-func (account *Account) AfterFind() {
-	account.Roles = strings.Split(account.RolesSerialized, ",")
+func (account *Account) AfterFind(databaseConnection *gorm.DB) (err error) {
+	account.Roles, err = loadRoleNamesForAccount(databaseConnection, account.ID)
+	return
+}
+
+// IsValidLocale returns true if the locale is empty or looks like a language tag, e.g. sv, en-GB or sv_FI
+func IsValidLocale(locale string) bool {
+	return locale == "" || localePattern.MatchString(locale)
+}
+
+// IsExpired returns true if the account has an expiration time that has passed
+func (account *Account) IsExpired() bool {
+	return account.ExpiresAt != nil && !account.ExpiresAt.After(time.Now())
+}
+
+// IsPending returns true if the account signed up by itself and has not yet verified its email or been approved
+func (account *Account) IsPending() bool {
+	return account.Status == AccountUnverified || account.Status == AccountAwaitingApproval
+}
+
+// CanAuthenticate returns true if the account may get tokens, that is if it is neither expired nor pending
+func (account *Account) CanAuthenticate() bool {
+	return !account.IsExpired() && !account.IsPending()
 }
 
-// SetPassword will update the accounts password
+// SetExpiresAt will change when the account expires, nil means that it never expires
+func (account *Account) SetExpiresAt(expiresAt *time.Time) {
+	account.ExpiresAt = expiresAt
+	account.ExpiryWarningSentAt = nil
+}
+
+// MarkExpiryWarningSent will persist that the expiry warning has been sent, claimed is false if it was already marked (e.g. by another replica)
+func (account *Account) MarkExpiryWarningSent(databaseConnection *gorm.DB) (claimed bool, err error) {
+	now := time.Now()
+	result := databaseConnection.Model(&Account{}).Where("id = ? AND expiry_warning_sent_at IS NULL", account.ID).UpdateColumn("expiry_warning_sent_at", now)
+	err = result.Error
+	if err == nil && result.RowsAffected == 1 {
+		account.ExpiryWarningSentAt = &now
+		claimed = true
+	}
+
+	return
+}
+
+// SetPassword will update the accounts password, it is hashed with PasswordHashing
 func (account *Account) SetPassword(password string) (err error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hash, err := PasswordHashing.Hash(password)
 
 	if err == nil {
-		account.Password = string(hash)
+		now := time.Now()
+		account.Password = hash
+		account.PasswordChangedAt = &now
 	}
 
 	return
 }
 
+// IsPasswordExpired returns true if the password is older than the maximum age, 0 means that passwords never expire and an account that has not changed its password since before the change was recorded counts from when it was created
+func (account *Account) IsPasswordExpired(maximumAge time.Duration) bool {
+	if maximumAge <= 0 || account.Password == "" {
+		return false
+	}
+
+	changedAt := account.PasswordChangedAt
+	if changedAt == nil {
+		changedAt = account.CreatedAt
+	}
+
+	return changedAt != nil && changedAt.Add(maximumAge).Before(time.Now())
+}
+
+// RequiresPasswordChange returns true if the account has to change its password before it may get an access token, either because an administrator has required it or because the password has expired
+func (account *Account) RequiresPasswordChange(maximumAge time.Duration) bool {
+	return account.MustChangePassword || account.IsPasswordExpired(maximumAge)
+}
+
 // CompareHashedPasswordAgainst will compare a string with the accounts hashed password
 func (account *Account) CompareHashedPasswordAgainst(passwordToCompareAgainst string) error {
-	return bcrypt.CompareHashAndPassword([]byte(account.Password), []byte(passwordToCompareAgainst))
+	return comparePasswordHash(account.Password, passwordToCompareAgainst)
 }
 
-// SetPasswordResetToken will update the password reset token
+// SetPasswordResetToken will update the password reset token, it is hashed with PasswordHashing
 func (account *Account) SetPasswordResetToken(token string) (err error) {
-	hash, err := bcrypt.GenerateFromPassword([]byte(token), bcrypt.DefaultCost)
+	hash, err := PasswordHashing.Hash(token)
 
 	if err == nil {
-		account.PasswordResetToken = string(hash)
+		account.PasswordResetToken = hash
 	}
 
 	return
@@ -82,7 +172,137 @@ func (account *Account) SetPasswordResetToken(token string) (err error) {
 
 // CompareHashedPasswordResetTokenAgainst will compare a reset token string agains the accounts hashed reset token
 func (account *Account) CompareHashedPasswordResetTokenAgainst(passwordResetTokenToCompareAgainst string) error {
-	return bcrypt.CompareHashAndPassword([]byte(account.PasswordResetToken), []byte(passwordResetTokenToCompareAgainst))
+	return comparePasswordHash(account.PasswordResetToken, passwordResetTokenToCompareAgainst)
+}
+
+// rehashPassword will replace the stored hash of the password if it was made with another algorithm or other parameters than PasswordHashing, it is only replaced if the password has not been changed since the account was loaded
+func (account *Account) rehashPassword(databaseConnection *gorm.DB, password string) (err error) {
+	if !PasswordHashing.NeedsRehash(account.Password) {
+		return
+	}
+
+	hash, err := PasswordHashing.Hash(password)
+	if err != nil {
+		return
+	}
+
+	result := databaseConnection.
+		Model(&Account{}).
+		Where("id = ? AND password = ?", account.ID, account.Password).
+		UpdateColumn("password", hash)
+	err = result.Error
+	if err == nil && result.RowsAffected > 0 {
+		account.Password = hash
+	}
+
+	return
+}
+
+// SetLoginLinkToken will update the token of the login link, only a SHA-256 hash of it is kept since the token is already random
+func (account *Account) SetLoginLinkToken(token string) {
+	hash := sha256.Sum256([]byte(token))
+	account.LoginLinkToken = hex.EncodeToString(hash[:])
+}
+
+// RedeemLoginLinkToken will clear the login link token if it matches the token, it returns false if it did not match or was already redeemed so that a login link can only be used once
+func (account *Account) RedeemLoginLinkToken(databaseConnection *gorm.DB, token string) (redeemed bool, err error) {
+	hash := sha256.Sum256([]byte(token))
+
+	result := databaseConnection.
+		Model(&Account{}).
+		Where("id = ? AND login_link_token = ?", account.ID, hex.EncodeToString(hash[:])).
+		UpdateColumn("login_link_token", "")
+	if result.Error != nil {
+		err = result.Error
+		return
+	}
+
+	redeemed = result.RowsAffected > 0
+	if redeemed {
+		account.LoginLinkToken = ""
+	}
+
+	return
+}
+
+// SetVerificationToken will update the token that verifies the email of the account, only a SHA-256 hash of it is kept
+func (account *Account) SetVerificationToken(token string) {
+	hash := sha256.Sum256([]byte(token))
+	account.VerificationToken = hex.EncodeToString(hash[:])
+}
+
+// Verify will mark the email of the account as verified and change its status to the given one if the token matches, it returns false if it did not match or the email was already verified
+func (account *Account) Verify(databaseConnection *gorm.DB, token string, status string) (verified bool, err error) {
+	hash := sha256.Sum256([]byte(token))
+
+	result := databaseConnection.
+		Model(&Account{}).
+		Where("id = ? AND verification_token = ?", account.ID, hex.EncodeToString(hash[:])).
+		UpdateColumns(map[string]interface{}{"verification_token": "", "email_verified": true, "status": status})
+	if result.Error != nil {
+		err = result.Error
+		return
+	}
+
+	verified = result.RowsAffected > 0
+	if verified {
+		account.VerificationToken = ""
+		account.EmailVerified = true
+		account.Status = status
+	}
+
+	return
+}
+
+// Approve will activate the account if it is awaiting approval, it returns false if it was not
+func (account *Account) Approve(databaseConnection *gorm.DB) (approved bool, err error) {
+	result := databaseConnection.
+		Model(&Account{}).
+		Where("id = ? AND status = ?", account.ID, AccountAwaitingApproval).
+		UpdateColumn("status", "")
+	if result.Error != nil {
+		err = result.Error
+		return
+	}
+
+	approved = result.RowsAffected > 0
+	if approved {
+		account.Status = ""
+	}
+
+	return
+}
+
+// Reject will permanently remove the account if it is awaiting approval so that the email can sign up again, it returns false if it was not awaiting approval
+func (account *Account) Reject(databaseConnection *gorm.DB) (rejected bool, err error) {
+	transaction := databaseConnection.Begin()
+
+	result := transaction.
+		Unscoped().
+		Where("id = ? AND status = ?", account.ID, AccountAwaitingApproval).
+		Delete(&Account{})
+	if result.Error != nil || result.RowsAffected == 0 {
+		err = result.Error
+		transaction.Rollback()
+		return
+	}
+
+	err = deleteAccountsPermanently(transaction, []string{account.ID})
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Commit().Error
+	rejected = err == nil
+
+	return
+}
+
+// LoadAccountsAwaitingApproval will fetch the self-registered accounts that waits for an administrator to approve them, the oldest first
+func LoadAccountsAwaitingApproval(databaseConnection *gorm.DB) (accounts []Account, err error) {
+	err = databaseConnection.Where("status = ?", AccountAwaitingApproval).Order("created_at").Find(&accounts).Error
+	return
 }
 
 // LoadAccountFromEmailAndPassword is used when authenticating to verify that email and password combination is valid
@@ -95,8 +315,12 @@ func LoadAccountFromEmailAndPassword(databaseConnection *gorm.DB, email string,
 	err = account.CompareHashedPasswordAgainst(password)
 	if err != nil {
 		account = Account{}
+		return
 	}
 
+	// Upgrading the hash is not required to log in, if it fails it is tried again the next time
+	account.rehashPassword(databaseConnection, password)
+
 	return
 }
 
@@ -111,3 +335,109 @@ func LoadAccountFromID(databaseConnection *gorm.DB, id string) (account Account,
 	err = databaseConnection.Where("id = ?", id).First(&account).Error
 	return
 }
+
+// LoadAccountsExpiringBefore will fetch all accounts that has not yet expired but will do so before the given time
+func LoadAccountsExpiringBefore(databaseConnection *gorm.DB, before time.Time) (accounts []Account, err error) {
+	err = databaseConnection.Where("expires_at > ? AND expires_at <= ?", time.Now(), before).Order("expires_at").Find(&accounts).Error
+	return
+}
+
+// LoadAccountsPendingExpiryWarning will fetch all accounts expiring before the given time that has not been warned yet
+func LoadAccountsPendingExpiryWarning(databaseConnection *gorm.DB, before time.Time) (accounts []Account, err error) {
+	err = databaseConnection.Where("expires_at > ? AND expires_at <= ? AND expiry_warning_sent_at IS NULL", time.Now(), before).Find(&accounts).Error
+	return
+}
+
+// LoadDeletedAccountFromID will fetch an account that has been soft deleted from the persistence
+func LoadDeletedAccountFromID(databaseConnection *gorm.DB, id string) (account Account, err error) {
+	err = databaseConnection.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", id).First(&account).Error
+	return
+}
+
+// LoadDeletedAccounts will fetch all accounts that has been soft deleted but not yet purged
+func LoadDeletedAccounts(databaseConnection *gorm.DB) (accounts []Account, err error) {
+	err = databaseConnection.Unscoped().Where("deleted_at IS NOT NULL").Find(&accounts).Error
+	return
+}
+
+// Restore will undo a soft delete of the account
+func (account *Account) Restore(databaseConnection *gorm.DB) (err error) {
+	err = databaseConnection.Unscoped().Model(account).UpdateColumn("deleted_at", gorm.Expr("NULL")).Error
+	if err == nil {
+		account.DeletedAt = nil
+	}
+
+	return
+}
+
+// PurgeDeletedAccounts will permanently remove all accounts (and anything related to them) that was soft deleted before the given time
+func PurgeDeletedAccounts(databaseConnection *gorm.DB, deletedBefore time.Time) (purged int, err error) {
+	transaction := databaseConnection.Begin()
+
+	var ids []string
+	err = transaction.Unscoped().Model(&Account{}).Where("deleted_at IS NOT NULL AND deleted_at < ?", deletedBefore).Pluck("id", &ids).Error
+	if err != nil || len(ids) == 0 {
+		transaction.Rollback()
+		return
+	}
+
+	err = deleteAccountsPermanently(transaction, ids)
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Commit().Error
+	if err == nil {
+		purged = len(ids)
+	}
+
+	return
+}
+
+// deleteAccountsPermanently removes the accounts and anything related to them in the transaction
+func deleteAccountsPermanently(transaction *gorm.DB, ids []string) (err error) {
+	err = transaction.Where("account_id IN (?)", ids).Delete(&AccountRole{}).Error
+	if err != nil {
+		return
+	}
+
+	err = transaction.Where("account_id IN (?)", ids).Delete(&GroupMember{}).Error
+	if err != nil {
+		return
+	}
+
+	err = transaction.Where("account_id IN (?)", ids).Delete(&OrganizationMember{}).Error
+	if err != nil {
+		return
+	}
+
+	err = transaction.Where("account_id IN (?)", ids).Delete(&AccountAttribute{}).Error
+	if err != nil {
+		return
+	}
+
+	err = transaction.Where("account_id IN (?)", ids).Delete(&Consent{}).Error
+	if err != nil {
+		return
+	}
+
+	err = transaction.Where("account_id IN (?)", ids).Delete(&Invitation{}).Error
+	if err != nil {
+		return
+	}
+
+	err = transaction.Where("account_id IN (?)", ids).Delete(&PasswordHistoryEntry{}).Error
+	if err != nil {
+		return
+	}
+
+	// Impersonations made by a purged administrator are kept since they are the audit trail of other accounts
+	err = transaction.Where("account_id IN (?)", ids).Delete(&Impersonation{}).Error
+	if err != nil {
+		return
+	}
+
+	err = transaction.Unscoped().Where("id IN (?)", ids).Delete(&Account{}).Error
+	return
+}
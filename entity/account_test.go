@@ -2,6 +2,7 @@ package entity_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
@@ -25,13 +26,40 @@ func TestAccountBeforeSave(test *testing.T) {
 	assert.Equal(test, 0, len(account.ID))
 	account.BeforeSave()
 	assert.Equal(test, 36, len(account.ID))
-	assert.Equal(test, "administrator,user", account.RolesSerialized)
+	assert.Equal(test, "administrator,user", account.GetRolesSerialized())
 }
 
 func TestAccountAfterFind(test *testing.T) {
-	account := entity.Account{RolesSerialized: "administrator,user"}
-	account.AfterFind()
-	assert.Equal(test, []string{"administrator", "user"}, account.Roles)
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	account := entity.Account{Email: "user@example.com", Roles: []string{"user", "administrator"}}
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	loadedAccount, err := entity.LoadAccountFromID(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, []string{"administrator", "user"}, loadedAccount.Roles)
+}
+
+func TestAccountSaveWithUnknownRole(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	account := entity.Account{Email: "user@example.com", Roles: []string{"user", "nonexistent"}}
+	err = databaseConnection.Create(&account).Error
+	assert.Error(test, err)
+
+	_, err = entity.LoadAccountFromEmail(databaseConnection, "user@example.com")
+	assert.Error(test, err)
 }
 
 func TestAccountCompareHashedPasswordAgainst(test *testing.T) {
@@ -42,6 +70,29 @@ func TestAccountCompareHashedPasswordAgainst(test *testing.T) {
 	assert.NoError(test, err)
 }
 
+func TestAccountRequiresPasswordChange(test *testing.T) {
+	account := entity.Account{}
+	account.SetPassword("mysecretpassword")
+	assert.False(test, account.RequiresPasswordChange(0))
+	assert.False(test, account.RequiresPasswordChange(24*time.Hour))
+
+	changedAt := time.Now().Add(-48 * time.Hour)
+	account.PasswordChangedAt = &changedAt
+	assert.False(test, account.RequiresPasswordChange(0))
+	assert.True(test, account.RequiresPasswordChange(24*time.Hour))
+
+	account.PasswordChangedAt = nil
+	account.CreatedAt = &changedAt
+	assert.True(test, account.IsPasswordExpired(24*time.Hour))
+
+	invited := entity.Account{CreatedAt: &changedAt}
+	assert.False(test, invited.IsPasswordExpired(24*time.Hour))
+
+	account.SetPassword("mynewsecretpassword")
+	account.MustChangePassword = true
+	assert.True(test, account.RequiresPasswordChange(0))
+}
+
 func TestAccountCompareHashedPasswordResetTokenAgainst(test *testing.T) {
 	token := "mysecrettoken"
 	account := entity.Account{}
@@ -50,12 +101,115 @@ func TestAccountCompareHashedPasswordResetTokenAgainst(test *testing.T) {
 	assert.NoError(test, err)
 }
 
+func TestAccountRedeemLoginLinkToken(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	account := entity.Account{Email: "user@example.com"}
+	account.SetLoginLinkToken("mysecrettoken")
+	assert.NotEqual(test, "mysecrettoken", account.LoginLinkToken)
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	redeemed, err := account.RedeemLoginLinkToken(databaseConnection, "anothertoken")
+	assert.NoError(test, err)
+	assert.False(test, redeemed)
+
+	redeemed, err = account.RedeemLoginLinkToken(databaseConnection, "mysecrettoken")
+	assert.NoError(test, err)
+	assert.True(test, redeemed)
+
+	redeemed, err = account.RedeemLoginLinkToken(databaseConnection, "mysecrettoken")
+	assert.NoError(test, err)
+	assert.False(test, redeemed)
+}
+
+func TestAccountVerifyAndApprove(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	account := entity.Account{Email: "user@example.com", Status: entity.AccountUnverified}
+	account.SetVerificationToken("mysecrettoken")
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+	assert.False(test, account.CanAuthenticate())
+
+	verified, err := account.Verify(databaseConnection, "anothertoken", entity.AccountAwaitingApproval)
+	assert.NoError(test, err)
+	assert.False(test, verified)
+
+	verified, err = account.Verify(databaseConnection, "mysecrettoken", entity.AccountAwaitingApproval)
+	assert.NoError(test, err)
+	assert.True(test, verified)
+	assert.False(test, account.CanAuthenticate())
+
+	awaiting, err := entity.LoadAccountsAwaitingApproval(databaseConnection)
+	assert.NoError(test, err)
+	assert.Equal(test, 1, len(awaiting))
+	assert.True(test, awaiting[0].EmailVerified)
+
+	approved, err := account.Approve(databaseConnection)
+	assert.NoError(test, err)
+	assert.True(test, approved)
+
+	loadedAccount, err := entity.LoadAccountFromID(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.True(test, loadedAccount.CanAuthenticate())
+
+	approved, err = loadedAccount.Approve(databaseConnection)
+	assert.NoError(test, err)
+	assert.False(test, approved)
+
+	rejected, err := loadedAccount.Reject(databaseConnection)
+	assert.NoError(test, err)
+	assert.False(test, rejected)
+}
+
+func TestAccountReject(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	account := entity.Account{Email: "user@example.com", Roles: []string{"user"}, Status: entity.AccountAwaitingApproval}
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	rejected, err := account.Reject(databaseConnection)
+	assert.NoError(test, err)
+	assert.True(test, rejected)
+
+	accounts := 0
+	err = databaseConnection.Unscoped().Model(&entity.Account{}).Count(&accounts).Error
+	assert.NoError(test, err)
+	assert.Equal(test, 0, accounts)
+
+	roles := 0
+	err = databaseConnection.Model(&entity.AccountRole{}).Where("account_id = ?", account.ID).Count(&roles).Error
+	assert.NoError(test, err)
+	assert.Equal(test, 0, roles)
+
+	rejected, err = account.Reject(databaseConnection)
+	assert.NoError(test, err)
+	assert.False(test, rejected)
+}
+
 func TestAccountLoadAccountFromID(test *testing.T) {
 	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
 	assert.NoError(test, err)
 	defer databaseConnection.Close()
 
-	err = databaseConnection.AutoMigrate(&entity.Account{}).Error
+	err = entity.AutoMigrate(databaseConnection)
 	assert.NoError(test, err)
 
 	account := entity.Account{ID: uuid.Must(uuid.NewV4()).String(), Email: "user@example.com"}
@@ -73,7 +227,7 @@ func TestAccountLoadAccountFromEmailAndPassword(test *testing.T) {
 	assert.NoError(test, err)
 	defer databaseConnection.Close()
 
-	err = databaseConnection.AutoMigrate(&entity.Account{}).Error
+	err = entity.AutoMigrate(databaseConnection)
 	assert.NoError(test, err)
 
 	account := entity.Account{ID: uuid.Must(uuid.NewV4()).String(), Email: "user@example.com"}
@@ -92,7 +246,7 @@ func TestAccountLoadAccountFromEmailAndPasswordWithInvalidPassword(test *testing
 	assert.NoError(test, err)
 	defer databaseConnection.Close()
 
-	err = databaseConnection.AutoMigrate(&entity.Account{}).Error
+	err = entity.AutoMigrate(databaseConnection)
 	assert.NoError(test, err)
 
 	account := entity.Account{ID: uuid.Must(uuid.NewV4()).String(), Email: "user@example.com"}
@@ -110,7 +264,7 @@ func TestAccountLoadAccountFromEmailAndPasswordWithInvalidEmail(test *testing.T)
 	assert.NoError(test, err)
 	defer databaseConnection.Close()
 
-	err = databaseConnection.AutoMigrate(&entity.Account{}).Error
+	err = entity.AutoMigrate(databaseConnection)
 	assert.NoError(test, err)
 
 	account := entity.Account{ID: uuid.Must(uuid.NewV4()).String(), Email: "user@example.com"}
@@ -122,3 +276,115 @@ func TestAccountLoadAccountFromEmailAndPasswordWithInvalidEmail(test *testing.T)
 	assert.Error(test, err)
 	assert.Equal(test, "", loadedAccount.Email)
 }
+
+func TestAccountSoftDeleteAndRestore(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	account := entity.Account{ID: uuid.Must(uuid.NewV4()).String(), Email: "user@example.com"}
+	account.SetPassword("mysecretpassword")
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	err = databaseConnection.Delete(&account).Error
+	assert.NoError(test, err)
+
+	_, err = entity.LoadAccountFromEmailAndPassword(databaseConnection, account.Email, "mysecretpassword")
+	assert.Error(test, err)
+
+	deletedAccount, err := entity.LoadDeletedAccountFromID(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.NotNil(test, deletedAccount.DeletedAt)
+
+	err = deletedAccount.Restore(databaseConnection)
+	assert.NoError(test, err)
+
+	loadedAccount, err := entity.LoadAccountFromEmailAndPassword(databaseConnection, account.Email, "mysecretpassword")
+	assert.NoError(test, err)
+	assert.Equal(test, account.ID, loadedAccount.ID)
+}
+
+func TestAccountPurgeDeletedAccounts(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	account := entity.Account{ID: uuid.Must(uuid.NewV4()).String(), Email: "user@example.com"}
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	impersonation := entity.Impersonation{ActorID: uuid.Must(uuid.NewV4()).String(), AccountID: account.ID}
+	err = databaseConnection.Create(&impersonation).Error
+	assert.NoError(test, err)
+
+	err = databaseConnection.Delete(&account).Error
+	assert.NoError(test, err)
+
+	purged, err := entity.PurgeDeletedAccounts(databaseConnection, time.Now().Add(-time.Hour))
+	assert.NoError(test, err)
+	assert.Equal(test, 0, purged)
+
+	purged, err = entity.PurgeDeletedAccounts(databaseConnection, time.Now().Add(time.Hour))
+	assert.NoError(test, err)
+	assert.Equal(test, 1, purged)
+
+	_, err = entity.LoadDeletedAccountFromID(databaseConnection, account.ID)
+	assert.Error(test, err)
+
+	_, err = entity.LoadImpersonationFromID(databaseConnection, impersonation.ID)
+	assert.Error(test, err)
+}
+
+func TestAccountIsExpired(test *testing.T) {
+	account := entity.Account{}
+	assert.Equal(test, false, account.IsExpired())
+
+	future := time.Now().Add(time.Hour)
+	account.SetExpiresAt(&future)
+	assert.Equal(test, false, account.IsExpired())
+
+	past := time.Now().Add(-time.Hour)
+	account.SetExpiresAt(&past)
+	assert.Equal(test, true, account.IsExpired())
+}
+
+func TestAccountLoadAccountsPendingExpiryWarning(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	expiresAt := time.Now().Add(24 * time.Hour)
+	account := entity.Account{ID: uuid.Must(uuid.NewV4()).String(), Email: "user@example.com", ExpiresAt: &expiresAt}
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	accounts, err := entity.LoadAccountsPendingExpiryWarning(databaseConnection, time.Now().Add(time.Hour))
+	assert.NoError(test, err)
+	assert.Equal(test, 0, len(accounts))
+
+	accounts, err = entity.LoadAccountsPendingExpiryWarning(databaseConnection, time.Now().Add(48*time.Hour))
+	assert.NoError(test, err)
+	assert.Equal(test, 1, len(accounts))
+
+	claimed, err := accounts[0].MarkExpiryWarningSent(databaseConnection)
+	assert.NoError(test, err)
+	assert.Equal(test, true, claimed)
+
+	claimed, err = account.MarkExpiryWarningSent(databaseConnection)
+	assert.NoError(test, err)
+	assert.Equal(test, false, claimed)
+
+	accounts, err = entity.LoadAccountsPendingExpiryWarning(databaseConnection, time.Now().Add(48*time.Hour))
+	assert.NoError(test, err)
+	assert.Equal(test, 0, len(accounts))
+}
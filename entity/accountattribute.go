@@ -0,0 +1,97 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+)
+
+// MaximumAccountAttributes is how many attributes that one account may have
+const MaximumAccountAttributes = 20
+
+// MaximumAccountAttributeValueLength is the maximum length in characters of an attribute value
+const MaximumAccountAttributeValueLength = 255
+
+// MaximumAccountAttributesSize is the maximum total size in bytes of all keys and values of an account, this keeps the tokens small
+const MaximumAccountAttributesSize = 1024
+
+var accountAttributeKeyPattern = regexp.MustCompile("^[a-zA-Z][a-zA-Z0-9_]{0,49}$")
+
+// AccountAttribute is a key/value pair that describes an account, e.g. a membership tier or locale
+type AccountAttribute struct {
+	AccountID string `gorm:"primary_key;size:36"`
+	Key       string `gorm:"primary_key;size:50"`
+	Value     string `gorm:"not null;size:255"`
+}
+
+// ValidateAccountAttributes returns an error describing the first attribute that is not allowed
+func ValidateAccountAttributes(attributes map[string]string) error {
+	if len(attributes) > MaximumAccountAttributes {
+		return fmt.Errorf("An account can have at most %d attributes", MaximumAccountAttributes)
+	}
+
+	size := 0
+	for key, value := range attributes {
+		if !accountAttributeKeyPattern.MatchString(key) {
+			return errors.New("Attribute keys must start with a letter and may only contain letters, digits and underscores (at most 50 characters)")
+		}
+
+		if utf8.RuneCountInString(value) > MaximumAccountAttributeValueLength {
+			return fmt.Errorf("The attribute %s may be at most %d characters", key, MaximumAccountAttributeValueLength)
+		}
+
+		size += len(key) + len(value)
+	}
+
+	if size > MaximumAccountAttributesSize {
+		return fmt.Errorf("The attributes of an account may be at most %d bytes in total", MaximumAccountAttributesSize)
+	}
+
+	return nil
+}
+
+// LoadAccountAttributes will fetch all attributes of the account
+func LoadAccountAttributes(databaseConnection *gorm.DB, accountID string) (attributes map[string]string, err error) {
+	var rows []AccountAttribute
+	err = databaseConnection.Where("account_id = ?", accountID).Find(&rows).Error
+	if err != nil {
+		return
+	}
+
+	attributes = map[string]string{}
+	for _, row := range rows {
+		attributes[row.Key] = row.Value
+	}
+
+	return
+}
+
+// SaveAccountAttributes will validate and replace all attributes of the account
+func SaveAccountAttributes(databaseConnection *gorm.DB, accountID string, attributes map[string]string) (err error) {
+	err = ValidateAccountAttributes(attributes)
+	if err != nil {
+		return
+	}
+
+	transaction := databaseConnection.Begin()
+
+	err = transaction.Where("account_id = ?", accountID).Delete(&AccountAttribute{}).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	for key, value := range attributes {
+		err = transaction.Create(&AccountAttribute{AccountID: accountID, Key: key, Value: value}).Error
+		if err != nil {
+			transaction.Rollback()
+			return
+		}
+	}
+
+	err = transaction.Commit().Error
+	return
+}
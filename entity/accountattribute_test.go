@@ -0,0 +1,67 @@
+package entity_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveAccountAttributes(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	account := entity.Account{Email: "user@example.com"}
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	err = entity.SaveAccountAttributes(databaseConnection, account.ID, map[string]string{"tier": "gold", "locale": "sv-SE"})
+	assert.NoError(test, err)
+
+	err = entity.SaveAccountAttributes(databaseConnection, account.ID, map[string]string{"tier": "silver"})
+	assert.NoError(test, err)
+
+	attributes, err := entity.LoadAccountAttributes(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, map[string]string{"tier": "silver"}, attributes)
+}
+
+func TestSaveAccountAttributesWithInvalidAttributes(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	account := entity.Account{Email: "user@example.com"}
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	err = entity.SaveAccountAttributes(databaseConnection, account.ID, map[string]string{"tier": "gold"})
+	assert.NoError(test, err)
+
+	err = entity.SaveAccountAttributes(databaseConnection, account.ID, map[string]string{"1tier": "gold"})
+	assert.Error(test, err)
+	err = entity.SaveAccountAttributes(databaseConnection, account.ID, map[string]string{"tier": strings.Repeat("a", 256)})
+	assert.Error(test, err)
+
+	tooLarge := map[string]string{}
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		tooLarge[key] = strings.Repeat("a", 250)
+	}
+	err = entity.SaveAccountAttributes(databaseConnection, account.ID, tooLarge)
+	assert.Error(test, err)
+
+	attributes, err := entity.LoadAccountAttributes(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, map[string]string{"tier": "gold"}, attributes)
+}
@@ -0,0 +1,100 @@
+package entity
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// AccountQuery describes which accounts to list and in what order, empty properties are ignored
+type AccountQuery struct {
+	Email         string
+	Role          string
+	GroupID       string
+	Enabled       *bool
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Sort          string
+	Offset        int
+	Limit         int
+}
+
+var accountSortColumns = map[string]string{
+	"email":     "email",
+	"createdAt": "created_at",
+	"expiresAt": "expires_at",
+}
+
+// IsValidAccountSort returns true if sort is a property that accounts can be sorted by, prefix with - for descending order
+func IsValidAccountSort(sort string) bool {
+	_, exists := accountSortColumns[strings.TrimPrefix(sort, "-")]
+	return sort == "" || exists
+}
+
+// likePatternEscaper escapes the wildcards of LIKE with ! which, unlike a backslash, means the same in every supported database
+var likePatternEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// escapeLikePattern makes the text match itself in a LIKE pattern with ESCAPE '!'
+func escapeLikePattern(text string) string {
+	return likePatternEscaper.Replace(text)
+}
+
+// LoadAccounts will fetch one page of accounts matching the query together with the total number of matching accounts
+func LoadAccounts(databaseConnection *gorm.DB, query AccountQuery) (accounts []Account, total int, err error) {
+	filtered := databaseConnection.Model(&Account{})
+
+	if query.Email != "" {
+		filtered = filtered.Where("email LIKE ? ESCAPE '!'", "%"+escapeLikePattern(query.Email)+"%")
+	}
+
+	if query.Role != "" {
+		filtered = filtered.Where(
+			"id IN (SELECT account_roles.account_id FROM account_roles JOIN roles ON roles.id = account_roles.role_id WHERE roles.name = ?)",
+			query.Role,
+		)
+	}
+
+	if query.GroupID != "" {
+		filtered = filtered.Where("id IN (SELECT account_id FROM group_members WHERE group_id = ?)", query.GroupID)
+	}
+
+	// Enabled matches CanAuthenticate, an account is disabled if it has expired or is pending
+	if query.Enabled != nil {
+		pendingStatuses := []string{AccountUnverified, AccountAwaitingApproval}
+		if *query.Enabled {
+			filtered = filtered.Where("(expires_at IS NULL OR expires_at > ?) AND (status IS NULL OR status NOT IN (?))", time.Now(), pendingStatuses)
+		} else {
+			filtered = filtered.Where("expires_at <= ? OR status IN (?)", time.Now(), pendingStatuses)
+		}
+	}
+
+	if query.CreatedAfter != nil {
+		filtered = filtered.Where("created_at >= ?", *query.CreatedAfter)
+	}
+
+	if query.CreatedBefore != nil {
+		filtered = filtered.Where("created_at < ?", *query.CreatedBefore)
+	}
+
+	err = filtered.Count(&total).Error
+	if err != nil {
+		return
+	}
+
+	order := "email"
+	if column, exists := accountSortColumns[strings.TrimPrefix(query.Sort, "-")]; exists {
+		order = column
+		if strings.HasPrefix(query.Sort, "-") {
+			order += " DESC"
+		}
+	}
+
+	paged := filtered.Order(order).Order("id")
+	if query.Limit > 0 {
+		paged = paged.Offset(query.Offset).Limit(query.Limit)
+	}
+
+	err = paged.Find(&accounts).Error
+	return
+}
@@ -0,0 +1,91 @@
+package entity_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountQueryLoadAccounts(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	expired := time.Now().Add(-time.Hour)
+	accounts := []entity.Account{
+		{Email: "anna@example.com", Roles: []string{"user"}},
+		{Email: "bertil@example.com", Roles: []string{"user", "administrator"}},
+		{Email: "cecilia@example.org", Roles: []string{"administrator"}},
+		{Email: "david@example.org", Roles: []string{"user"}, ExpiresAt: &expired},
+		{Email: "erik@example.net", Roles: []string{"user"}, Status: entity.AccountAwaitingApproval},
+	}
+	for index := range accounts {
+		err = databaseConnection.Create(&accounts[index]).Error
+		assert.NoError(test, err)
+	}
+
+	loaded, total, err := entity.LoadAccounts(databaseConnection, entity.AccountQuery{Email: "example.org"})
+	assert.NoError(test, err)
+	assert.Equal(test, 2, total)
+	assert.Equal(test, "cecilia@example.org", loaded[0].Email)
+
+	loaded, total, err = entity.LoadAccounts(databaseConnection, entity.AccountQuery{Role: "administrator", Sort: "-email"})
+	assert.NoError(test, err)
+	assert.Equal(test, 2, total)
+	assert.Equal(test, "cecilia@example.org", loaded[0].Email)
+	assert.Equal(test, "bertil@example.com", loaded[1].Email)
+
+	enabled := false
+	loaded, total, err = entity.LoadAccounts(databaseConnection, entity.AccountQuery{Enabled: &enabled})
+	assert.NoError(test, err)
+	assert.Equal(test, 2, total)
+	assert.Equal(test, "david@example.org", loaded[0].Email)
+	assert.Equal(test, "erik@example.net", loaded[1].Email)
+
+	enabled = true
+	_, total, err = entity.LoadAccounts(databaseConnection, entity.AccountQuery{Enabled: &enabled})
+	assert.NoError(test, err)
+	assert.Equal(test, 3, total)
+
+	loaded, total, err = entity.LoadAccounts(databaseConnection, entity.AccountQuery{Offset: 2, Limit: 1})
+	assert.NoError(test, err)
+	assert.Equal(test, 5, total)
+	assert.Equal(test, 1, len(loaded))
+	assert.Equal(test, "cecilia@example.org", loaded[0].Email)
+}
+
+func TestAccountQueryEmailIsNotAPattern(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	for _, email := range []string{"a_b@example.com", "axb@example.com", "100%@example.com", "1000@example.com"} {
+		err = databaseConnection.Create(&entity.Account{Email: email, Roles: []string{"user"}}).Error
+		assert.NoError(test, err)
+	}
+
+	loaded, total, err := entity.LoadAccounts(databaseConnection, entity.AccountQuery{Email: "a_b"})
+	assert.NoError(test, err)
+	assert.Equal(test, 1, total)
+	assert.Equal(test, "a_b@example.com", loaded[0].Email)
+
+	loaded, total, err = entity.LoadAccounts(databaseConnection, entity.AccountQuery{Email: "0%"})
+	assert.NoError(test, err)
+	assert.Equal(test, 1, total)
+	assert.Equal(test, "100%@example.com", loaded[0].Email)
+
+	_, total, err = entity.LoadAccounts(databaseConnection, entity.AccountQuery{Email: "!"})
+	assert.NoError(test, err)
+	assert.Equal(test, 0, total)
+}
@@ -0,0 +1,189 @@
+package entity
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// breachedPasswordPrefixLength is how many hex characters of the hash that the index is made of, 3 characters gives 4096 buckets
+const breachedPasswordPrefixLength = 3
+
+// breachedPasswordLinearScanSize is the size in bytes below which a range of the file is scanned line by line instead of being divided further
+const breachedPasswordLinearScanSize = 8192
+
+// ErrInvalidBreachedPasswordList is returned when the file does not look like a sorted list of SHA-1 hashes
+var ErrInvalidBreachedPasswordList = errors.New("The breached password file must contain upper case SHA-1 hashes sorted in ascending order, one per line optionally followed by :count")
+
+// BreachedPasswordList looks up passwords in a file of SHA-1 hashes of passwords known from breaches, sorted by hash with one HASH:COUNT per line as in the downloadable Pwned Passwords list, the file is never read into memory but an index of where each hash prefix starts is kept
+type BreachedPasswordList struct {
+	file  *os.File
+	size  int64
+	index []int64
+}
+
+// LoadBreachedPasswordList will open the file and index it
+func LoadBreachedPasswordList(path string) (list *BreachedPasswordList, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return
+	}
+
+	list = &BreachedPasswordList{file: file, size: info.Size()}
+
+	_, firstHash, err := list.lineAfter(0)
+	if err != nil || len(firstHash) != sha1.Size*2 {
+		file.Close()
+		list = nil
+		err = ErrInvalidBreachedPasswordList
+		return
+	}
+
+	buckets := 1 << (4 * breachedPasswordPrefixLength)
+	list.index = make([]int64, buckets+1)
+	list.index[buckets] = list.size
+	for bucket := 0; bucket < buckets; bucket++ {
+		prefix := strings.ToUpper(strconv.FormatInt(int64(bucket), 16))
+		prefix = strings.Repeat("0", breachedPasswordPrefixLength-len(prefix)) + prefix
+
+		list.index[bucket], err = list.search(prefix, 0, list.size)
+		if err != nil {
+			file.Close()
+			list = nil
+			return
+		}
+	}
+
+	return
+}
+
+// Contains returns true if the password is in the list
+func (list *BreachedPasswordList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	bucket, err := strconv.ParseInt(hash[:breachedPasswordPrefixLength], 16, 64)
+	if err != nil {
+		return false, err
+	}
+
+	offset, err := list.search(hash, list.index[bucket], list.index[bucket+1])
+	if err != nil || offset >= list.size {
+		return false, err
+	}
+
+	_, found, err := list.lineAfter(offset)
+	return found == hash, err
+}
+
+// Close will close the file of the list
+func (list *BreachedPasswordList) Close() error {
+	return list.file.Close()
+}
+
+// search returns the offset of the first line between start and end (both offsets of line starts) whose hash is not less than the target
+func (list *BreachedPasswordList) search(target string, start int64, end int64) (offset int64, err error) {
+	low, high := start, end
+	for high-low > breachedPasswordLinearScanSize {
+		middle := low + (high-low)/2
+
+		var lineStart int64
+		var hash string
+		lineStart, hash, err = list.lineAfter(middle)
+		if err != nil {
+			return
+		}
+
+		if lineStart >= high {
+			break
+		}
+
+		if hash < target {
+			low = lineStart
+		} else {
+			high = lineStart
+		}
+	}
+
+	offset = low
+	for offset < end {
+		var hash string
+		_, hash, err = list.lineAfter(offset)
+		if err != nil || hash >= target {
+			return
+		}
+
+		offset, err = list.nextLine(offset)
+		if err != nil {
+			return
+		}
+	}
+
+	return end, nil
+}
+
+// lineAfter returns the start and hash of the first line that starts at or after the offset
+func (list *BreachedPasswordList) lineAfter(offset int64) (lineStart int64, hash string, err error) {
+	lineStart = offset
+	if offset > 0 {
+		// The line starts at the offset only if the previous byte ends a line
+		lineStart, err = list.nextLine(offset - 1)
+		if err != nil {
+			return
+		}
+	}
+
+	if lineStart >= list.size {
+		return
+	}
+
+	buffer := make([]byte, 128)
+	read, err := list.file.ReadAt(buffer, lineStart)
+	if err == io.EOF {
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+
+	line := buffer[:read]
+	if end := bytes.IndexAny(line, ":\r\n"); end >= 0 {
+		line = line[:end]
+	}
+	hash = string(line)
+
+	return
+}
+
+// nextLine returns the offset of the line after the one that the offset is in
+func (list *BreachedPasswordList) nextLine(offset int64) (int64, error) {
+	buffer := make([]byte, 128)
+	for offset < list.size {
+		read, err := list.file.ReadAt(buffer, offset)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		if newline := bytes.IndexByte(buffer[:read], '\n'); newline >= 0 {
+			return offset + int64(newline) + 1, nil
+		}
+
+		offset += int64(read)
+		if read == 0 {
+			break
+		}
+	}
+
+	return list.size, nil
+}
@@ -0,0 +1,99 @@
+package entity_test
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeBreachedPasswordFile(test *testing.T, count int, passwords ...string) string {
+	lines := []string{}
+	for index := 0; index < count; index++ {
+		passwords = append(passwords, fmt.Sprintf("generated-password-%d", index))
+	}
+	for index, password := range passwords {
+		sum := sha1.Sum([]byte(password))
+		lines = append(lines, fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), index+1))
+	}
+	sort.Strings(lines)
+
+	file, err := ioutil.TempFile("", "breached-passwords")
+	assert.NoError(test, err)
+	defer file.Close()
+
+	_, err = file.WriteString(strings.Join(lines, "\r\n") + "\r\n")
+	assert.NoError(test, err)
+
+	return file.Name()
+}
+
+func TestBreachedPasswordListContains(test *testing.T) {
+	path := writeBreachedPasswordFile(test, 5000, "password", "correct horse battery staple")
+	defer os.Remove(path)
+
+	list, err := entity.LoadBreachedPasswordList(path)
+	assert.NoError(test, err)
+	defer list.Close()
+
+	for _, password := range []string{"password", "correct horse battery staple", "generated-password-0", "generated-password-4999"} {
+		breached, err := list.Contains(password)
+		assert.NoError(test, err)
+		assert.True(test, breached, password)
+	}
+
+	breached, err := list.Contains("not in the list")
+	assert.NoError(test, err)
+	assert.False(test, breached)
+}
+
+func TestBreachedPasswordListInPasswordPolicy(test *testing.T) {
+	path := writeBreachedPasswordFile(test, 0, "password1234")
+	defer os.Remove(path)
+
+	list, err := entity.LoadBreachedPasswordList(path)
+	assert.NoError(test, err)
+	defer list.Close()
+
+	policy := entity.DefaultPasswordPolicy()
+	policy.BreachedPasswords = list
+
+	violations, err := policy.Check("password1234", "user@example.com")
+	assert.NoError(test, err)
+	assert.Equal(test, 1, len(violations))
+	assert.Equal(test, "breached", violations[0].Rule)
+}
+
+func TestBreachedPasswordListThatCannotBeRead(test *testing.T) {
+	path := writeBreachedPasswordFile(test, 0, "password1234")
+	defer os.Remove(path)
+
+	list, err := entity.LoadBreachedPasswordList(path)
+	assert.NoError(test, err)
+	list.Close()
+
+	policy := entity.DefaultPasswordPolicy()
+	policy.BreachedPasswords = list
+
+	violations, err := policy.Check("password1234", "user@example.com")
+	assert.Error(test, err)
+	assert.Equal(test, 0, len(violations))
+}
+
+func TestLoadBreachedPasswordListWithInvalidFile(test *testing.T) {
+	file, err := ioutil.TempFile("", "breached-passwords")
+	assert.NoError(test, err)
+	file.WriteString("not a hash\n")
+	file.Close()
+	defer os.Remove(file.Name())
+
+	_, err = entity.LoadBreachedPasswordList(file.Name())
+	assert.Equal(test, entity.ErrInvalidBreachedPasswordList, err)
+}
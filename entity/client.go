@@ -0,0 +1,163 @@
+package entity
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Client represents an application that requests tokens on behalf of accounts, it can only be given the scopes that it is allowed and unless it is a first party client the account has to consent to them
+type Client struct {
+	ID          string   `json:"id" gorm:"primary_key;size:36" validate:"uuid4,required"`
+	RealmID     string   `json:"-" gorm:"size:50;unique_index:idx_clients_realm_name"`
+	Name        string   `json:"name" gorm:"not null;size:100;unique_index:idx_clients_realm_name" validate:"required,max=100"`
+	Description string   `json:"description" gorm:"size:255" validate:"max=255"`
+	FirstParty  bool     `json:"firstParty"`
+	Scopes      []string `json:"scopes" gorm:"-"`
+	SecretHash  string   `json:"-" gorm:"size:64"`
+}
+
+// ClientScope joins clients with the scopes that they are allowed to request
+type ClientScope struct {
+	ClientID string `gorm:"primary_key;size:36"`
+	ScopeID  string `gorm:"primary_key;size:36;index"`
+}
+
+// BeforeSave will run before the struct is persisted with gorm
+func (client *Client) BeforeSave() {
+	if client.ID == "" {
+		client.ID = uuid.Must(uuid.NewV4()).String()
+	}
+
+	if client.RealmID == "" {
+		client.RealmID = DefaultRealm
+	}
+}
+
+// AfterSave will run after the struct has been persisted with gorm and replaces the allowed scopes
+func (client *Client) AfterSave(databaseConnection *gorm.DB) (err error) {
+	scopes, err := LoadScopesFromNames(InRealm(databaseConnection, client.RealmID), client.Scopes)
+	if err != nil {
+		return
+	}
+
+	err = databaseConnection.Where("client_id = ?", client.ID).Delete(&ClientScope{}).Error
+	if err != nil {
+		return
+	}
+
+	for _, scope := range scopes {
+		err = databaseConnection.Create(&ClientScope{ClientID: client.ID, ScopeID: scope.ID}).Error
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// AfterFind will run after the struct has been read from persistence
+func (client *Client) AfterFind(databaseConnection *gorm.DB) (err error) {
+	err = databaseConnection.
+		Table("scopes").
+		Joins("JOIN client_scopes ON client_scopes.scope_id = scopes.id").
+		Where("client_scopes.client_id = ?", client.ID).
+		Order("scopes.name").
+		Pluck("scopes.name", &client.Scopes).
+		Error
+
+	if client.Scopes == nil {
+		client.Scopes = []string{}
+	}
+
+	return
+}
+
+// AllowedScopes returns the scopes among the requested that the client is allowed, if none was requested all allowed scopes are returned
+func (client *Client) AllowedScopes(requested []string) (allowed []string) {
+	if len(requested) == 0 {
+		return append([]string{}, client.Scopes...)
+	}
+
+	allowed = []string{}
+	for _, scope := range uniqueStrings(requested) {
+		for _, clientScope := range client.Scopes {
+			if scope == clientScope {
+				allowed = append(allowed, scope)
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// GenerateSecret gives the client a new secret that replaces the previous one, only a hash of it is stored so it can only be shown when it is generated
+func (client *Client) GenerateSecret() (secret string, err error) {
+	randomBytes := make([]byte, 32)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		return
+	}
+
+	secret = base64.RawURLEncoding.EncodeToString(randomBytes)
+	client.SecretHash = hashClientSecret(secret)
+	return
+}
+
+// MatchesSecret returns true if the client has a secret and it is the given one
+func (client *Client) MatchesSecret(secret string) bool {
+	if client.SecretHash == "" || secret == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(hashClientSecret(secret))) == 1
+}
+
+// Delete will remove the client and all consents given to it
+func (client *Client) Delete(databaseConnection *gorm.DB) (err error) {
+	transaction := databaseConnection.Begin()
+
+	err = transaction.Where("client_id = ?", client.ID).Delete(&ClientScope{}).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Where("client_id = ?", client.ID).Delete(&Consent{}).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Delete(client).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Commit().Error
+	return
+}
+
+// LoadClients will fetch all clients ordered by name
+func LoadClients(databaseConnection *gorm.DB) (clients []Client, err error) {
+	err = databaseConnection.Order("name").Find(&clients).Error
+	return
+}
+
+// LoadClientFromID will fetch the client from the persistence
+func LoadClientFromID(databaseConnection *gorm.DB, id string) (client Client, err error) {
+	err = databaseConnection.Where("id = ?", id).First(&client).Error
+	return
+}
+
+func hashClientSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,91 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Consent records that an account allows a client to request a scope on its behalf
+type Consent struct {
+	AccountID string     `gorm:"primary_key;size:36"`
+	ClientID  string     `gorm:"primary_key;size:36;index"`
+	ScopeID   string     `gorm:"primary_key;size:36;index"`
+	CreatedAt *time.Time `gorm:"index"`
+}
+
+// ClientConsent lists the scopes that an account has consented to for one client
+type ClientConsent struct {
+	ClientID   string     `json:"clientId"`
+	ClientName string     `json:"clientName"`
+	Scopes     []string   `json:"scopes"`
+	GrantedAt  *time.Time `json:"grantedAt,omitempty"`
+}
+
+// GrantConsent will let the client request the scopes on behalf of the account, scopes that have already been consented to are left as they are
+func GrantConsent(databaseConnection *gorm.DB, accountID string, clientID string, scopes []Scope) (err error) {
+	for _, scope := range scopes {
+		err = databaseConnection.Where(Consent{AccountID: accountID, ClientID: clientID, ScopeID: scope.ID}).FirstOrCreate(&Consent{}).Error
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// RevokeConsent will remove every consent that the account has given the client
+func RevokeConsent(databaseConnection *gorm.DB, accountID string, clientID string) error {
+	return databaseConnection.Where("account_id = ? AND client_id = ?", accountID, clientID).Delete(&Consent{}).Error
+}
+
+// LoadConsentedScopeNames will fetch the names of the scopes that the account has consented to for the client
+func LoadConsentedScopeNames(databaseConnection *gorm.DB, accountID string, clientID string) (names []string, err error) {
+	err = databaseConnection.
+		Table("scopes").
+		Joins("JOIN consents ON consents.scope_id = scopes.id").
+		Where("consents.account_id = ? AND consents.client_id = ?", accountID, clientID).
+		Order("scopes.name").
+		Pluck("scopes.name", &names).
+		Error
+	return
+}
+
+// LoadConsentsForAccount will fetch the consents of the account grouped by client
+func LoadConsentsForAccount(databaseConnection *gorm.DB, accountID string) (consents []ClientConsent, err error) {
+	rows, err := databaseConnection.
+		Table("consents").
+		Select("clients.id, clients.name, scopes.name, consents.created_at").
+		Joins("JOIN clients ON clients.id = consents.client_id").
+		Joins("JOIN scopes ON scopes.id = consents.scope_id").
+		Where("consents.account_id = ?", accountID).
+		Order("clients.name, clients.id, scopes.name").
+		Rows()
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	consents = []ClientConsent{}
+	for rows.Next() {
+		var clientID, clientName, scopeName string
+		var grantedAt *time.Time
+		err = rows.Scan(&clientID, &clientName, &scopeName, &grantedAt)
+		if err != nil {
+			return
+		}
+
+		if len(consents) == 0 || consents[len(consents)-1].ClientID != clientID {
+			consents = append(consents, ClientConsent{ClientID: clientID, ClientName: clientName, Scopes: []string{}})
+		}
+
+		consent := &consents[len(consents)-1]
+		consent.Scopes = append(consent.Scopes, scopeName)
+		if grantedAt != nil && (consent.GrantedAt == nil || grantedAt.Before(*consent.GrantedAt)) {
+			consent.GrantedAt = grantedAt
+		}
+	}
+
+	err = rows.Err()
+	return
+}
@@ -0,0 +1,95 @@
+package entity_test
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientAllowedScopes(test *testing.T) {
+	client := entity.Client{Scopes: []string{"calendar", "profile"}}
+
+	assert.Equal(test, []string{"calendar", "profile"}, client.AllowedScopes(nil))
+	assert.Equal(test, []string{"profile"}, client.AllowedScopes([]string{"profile", "billing", "profile"}))
+	assert.Equal(test, []string{}, client.AllowedScopes([]string{"billing"}))
+}
+
+func TestClientSecret(test *testing.T) {
+	client := entity.Client{}
+	assert.Equal(test, false, client.MatchesSecret(""))
+
+	secret, err := client.GenerateSecret()
+	assert.NoError(test, err)
+	assert.NotEqual(test, "", secret)
+	assert.NotEqual(test, secret, client.SecretHash)
+	assert.Equal(test, true, client.MatchesSecret(secret))
+	assert.Equal(test, false, client.MatchesSecret(""))
+	assert.Equal(test, false, client.MatchesSecret(secret+"x"))
+
+	previousSecret := secret
+	secret, err = client.GenerateSecret()
+	assert.NoError(test, err)
+	assert.Equal(test, true, client.MatchesSecret(secret))
+	assert.Equal(test, false, client.MatchesSecret(previousSecret))
+}
+
+func TestGrantAndRevokeConsent(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	profile := entity.Scope{Name: "profile", Roles: []string{"user"}}
+	err = databaseConnection.Create(&profile).Error
+	assert.NoError(test, err)
+	calendar := entity.Scope{Name: "calendar", Roles: []string{"user"}}
+	err = databaseConnection.Create(&calendar).Error
+	assert.NoError(test, err)
+
+	client := entity.Client{Name: "Calendar app", Scopes: []string{"calendar", "profile"}}
+	err = databaseConnection.Create(&client).Error
+	assert.NoError(test, err)
+
+	loadedClient, err := entity.LoadClientFromID(databaseConnection, client.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, []string{"calendar", "profile"}, loadedClient.Scopes)
+
+	account := entity.Account{Email: "user@example.com"}
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	err = entity.GrantConsent(databaseConnection, account.ID, client.ID, []entity.Scope{profile})
+	assert.NoError(test, err)
+	err = entity.GrantConsent(databaseConnection, account.ID, client.ID, []entity.Scope{profile, calendar})
+	assert.NoError(test, err)
+
+	consented, err := entity.LoadConsentedScopeNames(databaseConnection, account.ID, client.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, []string{"calendar", "profile"}, consented)
+
+	consents, err := entity.LoadConsentsForAccount(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, 1, len(consents))
+	assert.Equal(test, "Calendar app", consents[0].ClientName)
+	assert.Equal(test, []string{"calendar", "profile"}, consents[0].Scopes)
+
+	err = calendar.Delete(databaseConnection)
+	assert.NoError(test, err)
+
+	consented, err = entity.LoadConsentedScopeNames(databaseConnection, account.ID, client.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, []string{"profile"}, consented)
+
+	err = entity.RevokeConsent(databaseConnection, account.ID, client.ID)
+	assert.NoError(test, err)
+
+	consents, err = entity.LoadConsentsForAccount(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, 0, len(consents))
+}
@@ -0,0 +1,200 @@
+package entity
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DeviceAuthorizationPending is the status of a device authorization that the account has not yet approved or denied
+const DeviceAuthorizationPending = "pending"
+
+// DeviceAuthorizationApproved is the status of a device authorization that the account has approved
+const DeviceAuthorizationApproved = "approved"
+
+// DeviceAuthorizationDenied is the status of a device authorization that the account has denied
+const DeviceAuthorizationDenied = "denied"
+
+// ErrDeviceAuthorizationNotPending is returned when approving or denying a device authorization that has already been decided
+var ErrDeviceAuthorizationNotPending = errors.New("The device authorization is no longer pending")
+
+// userCodeCharacters are the characters of user codes, vowels are left out to avoid forming words and the rest are easy to tell apart (see RFC 8628)
+const userCodeCharacters = "BCDFGHJKLMNPQRSTVWXZ"
+
+// DeviceAuthorization is a pending login from a device that cannot show a login form (see RFC 8628), the device polls with the device code while the account approves it by entering the user code on another device
+type DeviceAuthorization struct {
+	DeviceCodeHash string     `json:"-" gorm:"primary_key;size:64"`
+	UserCode       string     `json:"userCode" gorm:"not null;size:8;unique_index"`
+	RealmID        string     `json:"-" gorm:"size:50;index"`
+	ClientID       string     `json:"clientId,omitempty" gorm:"size:36"`
+	Scope          string     `json:"scope,omitempty" gorm:"size:1000"`
+	AccountID      string     `json:"-" gorm:"size:36"`
+	Status         string     `json:"status" gorm:"not null;size:10"`
+	PollInterval   int        `json:"-"`
+	LastPolledAt   *time.Time `json:"-"`
+	CreatedAt      *time.Time `json:"createdAt,omitempty"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty" sql:"index"`
+}
+
+// FormattedUserCode returns the user code in the form that it is shown to the account, e.g. BCDF-GHJK
+func (authorization *DeviceAuthorization) FormattedUserCode() string {
+	return authorization.UserCode[:4] + "-" + authorization.UserCode[4:]
+}
+
+// IsExpired returns true if the device code can no longer be used
+func (authorization *DeviceAuthorization) IsExpired() bool {
+	return authorization.ExpiresAt == nil || authorization.ExpiresAt.Before(time.Now())
+}
+
+// CreateDeviceAuthorization will persist a new pending device authorization and return its device code, only a hash of the device code is stored
+func CreateDeviceAuthorization(databaseConnection *gorm.DB, realm string, clientID string, scope string, lifetime time.Duration, interval time.Duration) (deviceCode string, authorization DeviceAuthorization, err error) {
+	randomBytes := make([]byte, 32)
+	_, err = rand.Read(randomBytes)
+	if err != nil {
+		return
+	}
+	deviceCode = base64.RawURLEncoding.EncodeToString(randomBytes)
+
+	userCode, err := generateUserCode()
+	if err != nil {
+		return
+	}
+
+	expiresAt := time.Now().Add(lifetime)
+	authorization = DeviceAuthorization{
+		DeviceCodeHash: hashDeviceCode(deviceCode),
+		UserCode:       userCode,
+		RealmID:        realm,
+		ClientID:       clientID,
+		Scope:          scope,
+		Status:         DeviceAuthorizationPending,
+		PollInterval:   int(interval.Seconds()),
+		ExpiresAt:      &expiresAt,
+	}
+
+	err = databaseConnection.Create(&authorization).Error
+	return
+}
+
+// LoadDeviceAuthorizationFromDeviceCode will fetch the device authorization by the device code that was given to the device
+func LoadDeviceAuthorizationFromDeviceCode(databaseConnection *gorm.DB, deviceCode string) (authorization DeviceAuthorization, err error) {
+	err = databaseConnection.Where("device_code_hash = ?", hashDeviceCode(deviceCode)).First(&authorization).Error
+	return
+}
+
+// LoadPendingDeviceAuthorizationFromUserCode will fetch the pending and unexpired device authorization by the user code, the user code is matched regardless of case, spaces and dashes
+func LoadPendingDeviceAuthorizationFromUserCode(databaseConnection *gorm.DB, userCode string) (authorization DeviceAuthorization, err error) {
+	err = databaseConnection.
+		Where("user_code = ? AND status = ? AND expires_at > ?", normalizeUserCode(userCode), DeviceAuthorizationPending, time.Now()).
+		First(&authorization).
+		Error
+	return
+}
+
+// Approve will let the device get a token for the account
+func (authorization *DeviceAuthorization) Approve(databaseConnection *gorm.DB, accountID string) error {
+	return authorization.decide(databaseConnection, DeviceAuthorizationApproved, accountID)
+}
+
+// Deny will reject the device, it will get an access_denied error the next time it polls
+func (authorization *DeviceAuthorization) Deny(databaseConnection *gorm.DB) error {
+	return authorization.decide(databaseConnection, DeviceAuthorizationDenied, "")
+}
+
+func (authorization *DeviceAuthorization) decide(databaseConnection *gorm.DB, status string, accountID string) error {
+	result := databaseConnection.
+		Model(&DeviceAuthorization{}).
+		Where("device_code_hash = ? AND status = ?", authorization.DeviceCodeHash, DeviceAuthorizationPending).
+		Updates(map[string]interface{}{"status": status, "account_id": accountID})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrDeviceAuthorizationNotPending
+	}
+
+	authorization.Status = status
+	authorization.AccountID = accountID
+	return nil
+}
+
+// Poll records that the device polled for a token and returns false if it polled sooner than its interval allows, the interval is then increased by five seconds as required by RFC 8628
+func (authorization *DeviceAuthorization) Poll(databaseConnection *gorm.DB) (allowed bool, err error) {
+	now := time.Now()
+	earliest := now.Add(-time.Duration(authorization.PollInterval) * time.Second)
+
+	result := databaseConnection.
+		Model(&DeviceAuthorization{}).
+		Where("device_code_hash = ? AND (last_polled_at IS NULL OR last_polled_at <= ?)", authorization.DeviceCodeHash, earliest).
+		UpdateColumn("last_polled_at", now)
+	if result.Error != nil {
+		err = result.Error
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		allowed = true
+		return
+	}
+
+	authorization.PollInterval += 5
+	err = databaseConnection.
+		Model(&DeviceAuthorization{}).
+		Where("device_code_hash = ?", authorization.DeviceCodeHash).
+		UpdateColumns(map[string]interface{}{"poll_interval": authorization.PollInterval, "last_polled_at": now}).
+		Error
+	return
+}
+
+// Redeem will remove the approved device authorization so that the device code can only be exchanged for a token once, it returns false if it was already redeemed
+func (authorization *DeviceAuthorization) Redeem(databaseConnection *gorm.DB) (redeemed bool, err error) {
+	result := databaseConnection.
+		Where("device_code_hash = ? AND status = ?", authorization.DeviceCodeHash, DeviceAuthorizationApproved).
+		Delete(&DeviceAuthorization{})
+	err = result.Error
+	redeemed = err == nil && result.RowsAffected > 0
+	return
+}
+
+// PurgeExpiredDeviceAuthorizations will remove the device authorizations that expired before the time and returns how many that was removed
+func PurgeExpiredDeviceAuthorizations(databaseConnection *gorm.DB, before time.Time) (int, error) {
+	result := databaseConnection.Where("expires_at < ?", before).Delete(&DeviceAuthorization{})
+	return int(result.RowsAffected), result.Error
+}
+
+func generateUserCode() (string, error) {
+	userCode := make([]byte, 8)
+	for index := range userCode {
+		position, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeCharacters))))
+		if err != nil {
+			return "", err
+		}
+
+		userCode[index] = userCodeCharacters[position.Int64()]
+	}
+
+	return string(userCode), nil
+}
+
+func normalizeUserCode(userCode string) string {
+	return strings.Map(func(character rune) rune {
+		if character == '-' || character == ' ' {
+			return -1
+		}
+
+		return character
+	}, strings.ToUpper(userCode))
+}
+
+func hashDeviceCode(deviceCode string) string {
+	hash := sha256.Sum256([]byte(deviceCode))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,80 @@
+package entity_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceAuthorizationApproveAndRedeem(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	deviceCode, authorization, err := entity.CreateDeviceAuthorization(databaseConnection, entity.DefaultRealm, "", "", 10*time.Minute, 5*time.Second)
+	assert.NoError(test, err)
+	assert.NotEqual(test, deviceCode, authorization.DeviceCodeHash)
+
+	pending, err := entity.LoadPendingDeviceAuthorizationFromUserCode(databaseConnection, strings.ToLower(authorization.FormattedUserCode()))
+	assert.NoError(test, err)
+	assert.Equal(test, entity.DeviceAuthorizationPending, pending.Status)
+
+	polled, err := entity.LoadDeviceAuthorizationFromDeviceCode(databaseConnection, deviceCode)
+	assert.NoError(test, err)
+	allowed, err := polled.Poll(databaseConnection)
+	assert.NoError(test, err)
+	assert.True(test, allowed)
+	allowed, err = polled.Poll(databaseConnection)
+	assert.NoError(test, err)
+	assert.False(test, allowed)
+	assert.Equal(test, 10, polled.PollInterval)
+
+	err = pending.Approve(databaseConnection, uuid.Must(uuid.NewV4()).String())
+	assert.NoError(test, err)
+	err = pending.Deny(databaseConnection)
+	assert.Equal(test, entity.ErrDeviceAuthorizationNotPending, err)
+
+	_, err = entity.LoadPendingDeviceAuthorizationFromUserCode(databaseConnection, authorization.UserCode)
+	assert.Error(test, err)
+
+	approved, err := entity.LoadDeviceAuthorizationFromDeviceCode(databaseConnection, deviceCode)
+	assert.NoError(test, err)
+	assert.Equal(test, entity.DeviceAuthorizationApproved, approved.Status)
+
+	redeemed, err := approved.Redeem(databaseConnection)
+	assert.NoError(test, err)
+	assert.True(test, redeemed)
+	redeemed, err = approved.Redeem(databaseConnection)
+	assert.NoError(test, err)
+	assert.False(test, redeemed)
+}
+
+func TestPurgeExpiredDeviceAuthorizations(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	deviceCode, _, err := entity.CreateDeviceAuthorization(databaseConnection, entity.DefaultRealm, "", "", -time.Minute, 5*time.Second)
+	assert.NoError(test, err)
+	_, _, err = entity.CreateDeviceAuthorization(databaseConnection, entity.DefaultRealm, "", "", 10*time.Minute, 5*time.Second)
+	assert.NoError(test, err)
+
+	purged, err := entity.PurgeExpiredDeviceAuthorizations(databaseConnection, time.Now())
+	assert.NoError(test, err)
+	assert.Equal(test, 1, purged)
+
+	_, err = entity.LoadDeviceAuthorizationFromDeviceCode(databaseConnection, deviceCode)
+	assert.Error(test, err)
+}
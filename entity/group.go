@@ -0,0 +1,135 @@
+package entity
+
+import (
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Group represents a set of accounts that are all given the roles of the group
+type Group struct {
+	ID          string   `json:"id" gorm:"primary_key;size:36" validate:"uuid4,required"`
+	RealmID     string   `json:"-" gorm:"size:50;unique_index:idx_groups_realm_name"`
+	Name        string   `json:"name" gorm:"not null;size:100;unique_index:idx_groups_realm_name" validate:"required,max=100"`
+	Description string   `json:"description" gorm:"size:255" validate:"max=255"`
+	Roles       []string `json:"roles" gorm:"-"`
+}
+
+// GroupMember joins groups with their member accounts
+type GroupMember struct {
+	GroupID   string `gorm:"primary_key;size:36"`
+	AccountID string `gorm:"primary_key;size:36;index"`
+}
+
+// GroupRole joins groups with their roles
+type GroupRole struct {
+	GroupID string `gorm:"primary_key;size:36"`
+	RoleID  string `gorm:"primary_key;size:36;index"`
+}
+
+// BeforeSave will run before the struct is persisted with gorm
+func (group *Group) BeforeSave() {
+	if group.ID == "" {
+		group.ID = uuid.Must(uuid.NewV4()).String()
+	}
+
+	if group.RealmID == "" {
+		group.RealmID = DefaultRealm
+	}
+}
+
+// AfterSave will run after the struct has been persisted with gorm and replaces the groups role assignments
+func (group *Group) AfterSave(databaseConnection *gorm.DB) (err error) {
+	roles, err := LoadRolesFromNames(InRealm(databaseConnection, group.RealmID), group.Roles)
+	if err != nil {
+		return
+	}
+
+	err = databaseConnection.Where("group_id = ?", group.ID).Delete(&GroupRole{}).Error
+	if err != nil {
+		return
+	}
+
+	for _, role := range roles {
+		err = databaseConnection.Create(&GroupRole{GroupID: group.ID, RoleID: role.ID}).Error
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// AfterFind will run after the struct has been read from persistence
+func (group *Group) AfterFind(databaseConnection *gorm.DB) (err error) {
+	err = databaseConnection.
+		Table("roles").
+		Joins("JOIN group_roles ON group_roles.role_id = roles.id").
+		Where("group_roles.group_id = ?", group.ID).
+		Order("roles.name").
+		Pluck("roles.name", &group.Roles).
+		Error
+
+	if group.Roles == nil {
+		group.Roles = []string{}
+	}
+
+	return
+}
+
+// AddMember will make the account a member of the group unless it already is
+func (group *Group) AddMember(databaseConnection *gorm.DB, accountID string) error {
+	return databaseConnection.Where(GroupMember{GroupID: group.ID, AccountID: accountID}).FirstOrCreate(&GroupMember{}).Error
+}
+
+// RemoveMember will remove the account from the group
+func (group *Group) RemoveMember(databaseConnection *gorm.DB, accountID string) error {
+	return databaseConnection.Where("group_id = ? AND account_id = ?", group.ID, accountID).Delete(&GroupMember{}).Error
+}
+
+// Delete will remove the group and all of its memberships
+func (group *Group) Delete(databaseConnection *gorm.DB) (err error) {
+	transaction := databaseConnection.Begin()
+
+	err = transaction.Where("group_id = ?", group.ID).Delete(&GroupMember{}).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Where("group_id = ?", group.ID).Delete(&GroupRole{}).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Delete(group).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Commit().Error
+	return
+}
+
+// LoadGroups will fetch all groups ordered by name
+func LoadGroups(databaseConnection *gorm.DB) (groups []Group, err error) {
+	err = databaseConnection.Order("name").Find(&groups).Error
+	return
+}
+
+// LoadGroupFromID will fetch the group from the persistence
+func LoadGroupFromID(databaseConnection *gorm.DB, id string) (group Group, err error) {
+	err = databaseConnection.Where("id = ?", id).First(&group).Error
+	return
+}
+
+// LoadGroupsForAccount will fetch all groups that the account is a member of
+func LoadGroupsForAccount(databaseConnection *gorm.DB, accountID string) (groups []Group, err error) {
+	err = databaseConnection.
+		Where("id IN (SELECT group_id FROM group_members WHERE account_id = ?)", accountID).
+		Order("name").
+		Find(&groups).
+		Error
+	return
+}
@@ -0,0 +1,81 @@
+package entity_test
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupMembers(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	group := entity.Group{Name: "Board", Roles: []string{"administrator"}}
+	err = databaseConnection.Create(&group).Error
+	assert.NoError(test, err)
+
+	account := entity.Account{Email: "user@example.com", Roles: []string{"user"}}
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	err = group.AddMember(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	err = group.AddMember(databaseConnection, account.ID)
+	assert.NoError(test, err)
+
+	groups, err := entity.LoadGroupsForAccount(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, 1, len(groups))
+	assert.Equal(test, "Board", groups[0].Name)
+	assert.Equal(test, []string{"administrator"}, groups[0].Roles)
+
+	members, total, err := entity.LoadAccounts(databaseConnection, entity.AccountQuery{GroupID: group.ID})
+	assert.NoError(test, err)
+	assert.Equal(test, 1, total)
+	assert.Equal(test, account.ID, members[0].ID)
+
+	err = group.RemoveMember(databaseConnection, account.ID)
+	assert.NoError(test, err)
+
+	groups, err = entity.LoadGroupsForAccount(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, 0, len(groups))
+}
+
+func TestGroupDelete(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	group := entity.Group{Name: "Volunteers", Roles: []string{"user"}}
+	err = databaseConnection.Create(&group).Error
+	assert.NoError(test, err)
+
+	account := entity.Account{Email: "user@example.com"}
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	err = group.AddMember(databaseConnection, account.ID)
+	assert.NoError(test, err)
+
+	err = group.Delete(databaseConnection)
+	assert.NoError(test, err)
+
+	_, err = entity.LoadGroupFromID(databaseConnection, group.ID)
+	assert.Error(test, err)
+
+	groups, err := entity.LoadGroupsForAccount(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, 0, len(groups))
+}
@@ -0,0 +1,64 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Impersonation is the audit record of an administrator acting as another account, its id is used as the jti claim of the issued token so that it can be revoked
+type Impersonation struct {
+	ID        string     `json:"id" gorm:"primary_key;size:36"`
+	RealmID   string     `json:"-" gorm:"size:50;index"`
+	ActorID   string     `json:"actorId" gorm:"not null;size:36;index"`
+	AccountID string     `json:"accountId" gorm:"not null;size:36;index"`
+	Reason    string     `json:"reason" gorm:"size:255" validate:"max=255"`
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+	RevokedBy string     `json:"revokedBy,omitempty" gorm:"size:36"`
+}
+
+// BeforeSave will run before the struct is persisted with gorm
+func (impersonation *Impersonation) BeforeSave() {
+	if impersonation.ID == "" {
+		impersonation.ID = uuid.Must(uuid.NewV4()).String()
+	}
+
+	if impersonation.RealmID == "" {
+		impersonation.RealmID = DefaultRealm
+	}
+}
+
+// IsActive returns true if the impersonation has not been revoked and its token has not expired
+func (impersonation *Impersonation) IsActive() bool {
+	return impersonation.RevokedAt == nil && impersonation.ExpiresAt != nil && impersonation.ExpiresAt.After(time.Now())
+}
+
+// Revoke will mark the impersonation as revoked by the account, tokens issued for it will no longer be accepted by this service
+func (impersonation *Impersonation) Revoke(databaseConnection *gorm.DB, revokedBy string) error {
+	now := time.Now()
+	impersonation.RevokedAt = &now
+	impersonation.RevokedBy = revokedBy
+
+	return databaseConnection.Model(impersonation).Updates(map[string]interface{}{"revoked_at": now, "revoked_by": revokedBy}).Error
+}
+
+// LoadImpersonations will fetch all impersonations, the latest first
+func LoadImpersonations(databaseConnection *gorm.DB) (impersonations []Impersonation, err error) {
+	err = databaseConnection.Order("created_at DESC").Find(&impersonations).Error
+	return
+}
+
+// LoadImpersonationFromID will fetch the impersonation by id
+func LoadImpersonationFromID(databaseConnection *gorm.DB, id string) (impersonation Impersonation, err error) {
+	err = databaseConnection.Where("id = ?", id).First(&impersonation).Error
+	return
+}
+
+// IsImpersonationRevoked returns true if the impersonation has been revoked or does not exist
+func IsImpersonationRevoked(databaseConnection *gorm.DB, id string) bool {
+	impersonation, err := LoadImpersonationFromID(databaseConnection, id)
+	return err != nil || impersonation.RevokedAt != nil
+}
@@ -0,0 +1,49 @@
+package entity_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImpersonationRevoke(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	expiresAt := time.Now().Add(15 * time.Minute)
+	impersonation := entity.Impersonation{ActorID: uuid.Must(uuid.NewV4()).String(), AccountID: uuid.Must(uuid.NewV4()).String(), ExpiresAt: &expiresAt}
+	err = databaseConnection.Create(&impersonation).Error
+	assert.NoError(test, err)
+	assert.True(test, impersonation.IsActive())
+	assert.False(test, entity.IsImpersonationRevoked(databaseConnection, impersonation.ID))
+
+	err = impersonation.Revoke(databaseConnection, impersonation.ActorID)
+	assert.NoError(test, err)
+	assert.False(test, impersonation.IsActive())
+	assert.True(test, entity.IsImpersonationRevoked(databaseConnection, impersonation.ID))
+
+	loaded, err := entity.LoadImpersonationFromID(databaseConnection, impersonation.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, impersonation.ActorID, loaded.RevokedBy)
+	assert.NotNil(test, loaded.RevokedAt)
+}
+
+func TestIsImpersonationRevokedWithUnknownID(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	assert.True(test, entity.IsImpersonationRevoked(databaseConnection, uuid.Must(uuid.NewV4()).String()))
+}
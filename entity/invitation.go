@@ -0,0 +1,164 @@
+package entity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// InvitationPending is the status of an invitation that has been sent but not yet accepted
+const InvitationPending = "pending"
+
+// InvitationAccepted is the status of an invitation where the invitee has chosen a password
+const InvitationAccepted = "accepted"
+
+// InvitationExpired is the status of a pending invitation whose link is no longer valid, it is never persisted but derived from the expiration time
+const InvitationExpired = "expired"
+
+// InvitationRevoked is the status of an invitation that has been cancelled
+const InvitationRevoked = "revoked"
+
+// Invitation keeps track of an account that was created without a password and invited by email to choose one
+type Invitation struct {
+	ID         string     `json:"id" gorm:"primary_key;size:36"`
+	RealmID    string     `json:"-" gorm:"size:50;index"`
+	AccountID  string     `json:"accountId" gorm:"not null;size:36;index"`
+	Email      string     `json:"email" gorm:"size:100"`
+	InvitedBy  string     `json:"invitedBy,omitempty" gorm:"size:36"`
+	Status     string     `json:"status" gorm:"not null;size:10;index"`
+	TokenHash  string     `json:"-" gorm:"size:64"`
+	CreatedAt  *time.Time `json:"createdAt,omitempty"`
+	SentAt     *time.Time `json:"sentAt,omitempty"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	AcceptedAt *time.Time `json:"acceptedAt,omitempty"`
+}
+
+// BeforeSave will run before the struct is persisted with gorm
+func (invitation *Invitation) BeforeSave() {
+	if invitation.ID == "" {
+		invitation.ID = uuid.Must(uuid.NewV4()).String()
+	}
+
+	if invitation.RealmID == "" {
+		invitation.RealmID = DefaultRealm
+	}
+
+	if invitation.Status == InvitationExpired {
+		invitation.Status = InvitationPending
+	}
+}
+
+// AfterFind will run after the struct has been read from persistence and reports pending invitations past their expiration time as expired
+func (invitation *Invitation) AfterFind() (err error) {
+	if invitation.Status == InvitationPending && invitation.ExpiresAt != nil && invitation.ExpiresAt.Before(time.Now()) {
+		invitation.Status = InvitationExpired
+	}
+
+	return
+}
+
+// IsOpen returns true if the invitation can still be resent, accepted or revoked
+func (invitation *Invitation) IsOpen() bool {
+	return invitation.Status == InvitationPending || invitation.Status == InvitationExpired
+}
+
+// SetToken will replace the token of the invitation so that only the latest sent invitation link works, only a SHA-256 hash of the token is kept
+func (invitation *Invitation) SetToken(token string, expiresAt time.Time) {
+	now := time.Now()
+	invitation.TokenHash = hashInvitationToken(token)
+	invitation.SentAt = &now
+	invitation.ExpiresAt = &expiresAt
+	invitation.Status = InvitationPending
+}
+
+// MatchesToken returns true if the token is the one from the latest sent invitation link
+func (invitation *Invitation) MatchesToken(token string) bool {
+	return invitation.TokenHash == hashInvitationToken(token)
+}
+
+// Accept will mark the invitation as accepted and the email of the account as verified since the invitee received the invitation link, the caller runs it in the transaction that saves the password of the invitee so that both are saved together
+func (invitation *Invitation) Accept(databaseConnection *gorm.DB) (err error) {
+	now := time.Now()
+
+	err = databaseConnection.Model(&Invitation{}).Where("id = ?", invitation.ID).UpdateColumns(map[string]interface{}{"status": InvitationAccepted, "accepted_at": now}).Error
+	if err != nil {
+		return
+	}
+
+	err = databaseConnection.Model(&Account{}).Where("id = ?", invitation.AccountID).UpdateColumn("email_verified", true).Error
+	if err != nil {
+		return
+	}
+
+	invitation.Status = InvitationAccepted
+	invitation.AcceptedAt = &now
+
+	return
+}
+
+// Revoke will cancel the invitation and remove the reset token of the account so that the invitation link stops working
+func (invitation *Invitation) Revoke(databaseConnection *gorm.DB) (err error) {
+	transaction := databaseConnection.Begin()
+
+	err = transaction.Model(&Invitation{}).Where("id = ?", invitation.ID).UpdateColumn("status", InvitationRevoked).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Model(&Account{}).Where("id = ?", invitation.AccountID).UpdateColumn("password_reset_token", "").Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Commit().Error
+	if err == nil {
+		invitation.Status = InvitationRevoked
+	}
+
+	return
+}
+
+// LoadInvitations will fetch the invitations with the status, or all of them if the status is empty, the latest first
+func LoadInvitations(databaseConnection *gorm.DB, status string) (invitations []Invitation, err error) {
+	query := databaseConnection.Order("created_at DESC")
+
+	switch status {
+	case "":
+	case InvitationPending:
+		query = query.Where("status = ? AND expires_at >= ?", InvitationPending, time.Now())
+	case InvitationExpired:
+		query = query.Where("status = ? AND expires_at < ?", InvitationPending, time.Now())
+	default:
+		query = query.Where("status = ?", status)
+	}
+
+	err = query.Find(&invitations).Error
+	return
+}
+
+// LoadInvitationFromID will fetch the invitation by id
+func LoadInvitationFromID(databaseConnection *gorm.DB, id string) (invitation Invitation, err error) {
+	err = databaseConnection.Where("id = ?", id).First(&invitation).Error
+	return
+}
+
+// LoadOpenInvitationForAccount will fetch the pending (or expired) invitation of the account
+func LoadOpenInvitationForAccount(databaseConnection *gorm.DB, accountID string) (invitation Invitation, err error) {
+	err = databaseConnection.Where("account_id = ? AND status = ?", accountID, InvitationPending).Order("created_at DESC").First(&invitation).Error
+	return
+}
+
+// IsValidInvitationStatus returns true if the status can be used to filter invitations
+func IsValidInvitationStatus(status string) bool {
+	return status == "" || status == InvitationPending || status == InvitationAccepted || status == InvitationExpired || status == InvitationRevoked
+}
+
+func hashInvitationToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
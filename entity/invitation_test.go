@@ -0,0 +1,90 @@
+package entity_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvitationAccept(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	account := entity.Account{Email: "user@example.com"}
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	invitation := entity.Invitation{AccountID: account.ID, Email: account.Email}
+	invitation.SetToken("firsttoken", time.Now().Add(time.Hour))
+	invitation.SetToken("secondtoken", time.Now().Add(time.Hour))
+	err = databaseConnection.Create(&invitation).Error
+	assert.NoError(test, err)
+
+	open, err := entity.LoadOpenInvitationForAccount(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.False(test, open.MatchesToken("firsttoken"))
+	assert.True(test, open.MatchesToken("secondtoken"))
+
+	err = open.Accept(databaseConnection)
+	assert.NoError(test, err)
+
+	accepted, err := entity.LoadInvitations(databaseConnection, entity.InvitationAccepted)
+	assert.NoError(test, err)
+	assert.Equal(test, 1, len(accepted))
+
+	loadedAccount, err := entity.LoadAccountFromID(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.True(test, loadedAccount.EmailVerified)
+
+	_, err = entity.LoadOpenInvitationForAccount(databaseConnection, account.ID)
+	assert.Error(test, err)
+}
+
+func TestInvitationExpiredAndRevoked(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	account := entity.Account{Email: "user@example.com", PasswordResetToken: "hashedtoken"}
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	invitation := entity.Invitation{AccountID: account.ID, Email: account.Email}
+	invitation.SetToken("token", time.Now().Add(-time.Hour))
+	err = databaseConnection.Create(&invitation).Error
+	assert.NoError(test, err)
+
+	pending, err := entity.LoadInvitations(databaseConnection, entity.InvitationPending)
+	assert.NoError(test, err)
+	assert.Equal(test, 0, len(pending))
+
+	expired, err := entity.LoadInvitations(databaseConnection, entity.InvitationExpired)
+	assert.NoError(test, err)
+	assert.Equal(test, 1, len(expired))
+	assert.Equal(test, entity.InvitationExpired, expired[0].Status)
+	assert.True(test, expired[0].IsOpen())
+
+	err = expired[0].Revoke(databaseConnection)
+	assert.NoError(test, err)
+
+	revoked, err := entity.LoadInvitationFromID(databaseConnection, invitation.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, entity.InvitationRevoked, revoked.Status)
+	assert.False(test, revoked.IsOpen())
+
+	loadedAccount, err := entity.LoadAccountFromID(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, "", loadedAccount.PasswordResetToken)
+}
@@ -0,0 +1,95 @@
+package entity
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// AutoMigrate will create or update the tables for all entities and migrate any data that was persisted in a legacy format
+func AutoMigrate(databaseConnection *gorm.DB) (err error) {
+	err = databaseConnection.AutoMigrate(
+		&Realm{},
+		&RealmEmailTemplate{},
+		&RealmRegistration{},
+		&Account{},
+		&AccountAttribute{},
+		&Impersonation{},
+		&Role{},
+		&AccountRole{},
+		&RoleInclusion{},
+		&RolePermission{},
+		&Group{},
+		&GroupMember{},
+		&GroupRole{},
+		&Organization{},
+		&OrganizationMember{},
+		&Scope{},
+		&ScopeRole{},
+		&Client{},
+		&ClientScope{},
+		&Consent{},
+		&DeviceAuthorization{},
+		&Invitation{},
+		&PasswordHistoryEntry{},
+		&OutboxEmail{},
+	).Error
+	if err != nil {
+		return
+	}
+
+	err = migrateToRealms(databaseConnection)
+	if err != nil {
+		return
+	}
+
+	realms, err := LoadRealms(databaseConnection)
+	if err != nil {
+		return
+	}
+
+	for _, realm := range realms {
+		err = SetupRealm(databaseConnection, realm.Name)
+		if err != nil {
+			return
+		}
+	}
+
+	err = migrateSerializedRoles(databaseConnection)
+	return
+}
+
+// migrateToRealms creates the default realm and moves every entity that was persisted before realms existed into it
+func migrateToRealms(databaseConnection *gorm.DB) (err error) {
+	err = databaseConnection.Where(Realm{Name: DefaultRealm}).FirstOrCreate(&Realm{}).Error
+	if err != nil {
+		return
+	}
+
+	for _, table := range []string{"accounts", "roles", "groups"} {
+		err = databaseConnection.Table(table).Where("realm_id IS NULL OR realm_id = ''").UpdateColumn("realm_id", DefaultRealm).Error
+		if err != nil {
+			return
+		}
+	}
+
+	dropLegacyUniqueConstraints(databaseConnection)
+
+	return
+}
+
+// dropLegacyUniqueConstraints removes the unique constraints on accounts.email, roles.name and groups.name that was created before realms existed, they are now unique per realm instead
+func dropLegacyUniqueConstraints(databaseConnection *gorm.DB) {
+	columns := map[string]string{"accounts": "email", "roles": "name", "groups": "name"}
+
+	dialect := databaseConnection.Dialect()
+
+	for table, column := range columns {
+		switch dialect.GetName() {
+		case "mysql":
+			if dialect.HasIndex(table, column) {
+				databaseConnection.Exec("ALTER TABLE " + dialect.Quote(table) + " DROP INDEX " + dialect.Quote(column))
+			}
+		case "postgres":
+			databaseConnection.Exec("ALTER TABLE " + dialect.Quote(table) + " DROP CONSTRAINT IF EXISTS " + dialect.Quote(table+"_"+column+"_key"))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package entity
+
+import (
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Organization represents an organisation that accounts can be members of, each member has a role within the organisation
+type Organization struct {
+	ID          string `json:"id" gorm:"primary_key;size:36" validate:"uuid4,required"`
+	RealmID     string `json:"-" gorm:"size:50;unique_index:idx_organizations_realm_name"`
+	Name        string `json:"name" gorm:"not null;size:100;unique_index:idx_organizations_realm_name" validate:"required,max=100"`
+	Description string `json:"description" gorm:"size:255" validate:"max=255"`
+}
+
+// OrganizationMember joins organizations with their member accounts and the role that the account has in the organisation
+type OrganizationMember struct {
+	OrganizationID string `json:"organizationId" gorm:"primary_key;size:36"`
+	AccountID      string `json:"accountId" gorm:"primary_key;size:36;index"`
+	Role           string `json:"role" gorm:"not null;size:50" validate:"required,max=50"`
+}
+
+// BeforeSave will run before the struct is persisted with gorm
+func (organization *Organization) BeforeSave() {
+	if organization.ID == "" {
+		organization.ID = uuid.Must(uuid.NewV4()).String()
+	}
+
+	if organization.RealmID == "" {
+		organization.RealmID = DefaultRealm
+	}
+}
+
+// SetMember will make the account a member of the organization with the role, or change the role if it already is a member
+func (organization *Organization) SetMember(databaseConnection *gorm.DB, accountID string, role string) error {
+	return databaseConnection.
+		Where(OrganizationMember{OrganizationID: organization.ID, AccountID: accountID}).
+		Assign(OrganizationMember{Role: role}).
+		FirstOrCreate(&OrganizationMember{}).
+		Error
+}
+
+// RemoveMember will remove the account from the organization
+func (organization *Organization) RemoveMember(databaseConnection *gorm.DB, accountID string) error {
+	return databaseConnection.Where("organization_id = ? AND account_id = ?", organization.ID, accountID).Delete(&OrganizationMember{}).Error
+}
+
+// Delete will remove the organization and all of its memberships
+func (organization *Organization) Delete(databaseConnection *gorm.DB) (err error) {
+	transaction := databaseConnection.Begin()
+
+	err = transaction.Where("organization_id = ?", organization.ID).Delete(&OrganizationMember{}).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Delete(organization).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Commit().Error
+	return
+}
+
+// LoadOrganizations will fetch all organizations ordered by name
+func LoadOrganizations(databaseConnection *gorm.DB) (organizations []Organization, err error) {
+	err = databaseConnection.Order("name").Find(&organizations).Error
+	return
+}
+
+// LoadOrganizationFromID will fetch the organization from the persistence
+func LoadOrganizationFromID(databaseConnection *gorm.DB, id string) (organization Organization, err error) {
+	err = databaseConnection.Where("id = ?", id).First(&organization).Error
+	return
+}
+
+// LoadOrganizationMembers will fetch all memberships of the organization
+func LoadOrganizationMembers(databaseConnection *gorm.DB, organizationID string) (members []OrganizationMember, err error) {
+	err = databaseConnection.Where("organization_id = ?", organizationID).Order("account_id").Find(&members).Error
+	if members == nil {
+		members = []OrganizationMember{}
+	}
+
+	return
+}
+
+// LoadOrganizationMembershipsForAccount will fetch all memberships that the account has
+func LoadOrganizationMembershipsForAccount(databaseConnection *gorm.DB, accountID string) (members []OrganizationMember, err error) {
+	err = databaseConnection.Where("account_id = ?", accountID).Order("organization_id").Find(&members).Error
+	return
+}
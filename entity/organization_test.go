@@ -0,0 +1,46 @@
+package entity_test
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrganizationSetMember(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	organization := entity.Organization{Name: "Möjlighetsministeriet"}
+	err = databaseConnection.Create(&organization).Error
+	assert.NoError(test, err)
+
+	account := entity.Account{Email: "user@example.com"}
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	err = organization.SetMember(databaseConnection, account.ID, "member")
+	assert.NoError(test, err)
+	err = organization.SetMember(databaseConnection, account.ID, "treasurer")
+	assert.NoError(test, err)
+
+	memberships, err := entity.LoadOrganizationMembershipsForAccount(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, 1, len(memberships))
+	assert.Equal(test, organization.ID, memberships[0].OrganizationID)
+	assert.Equal(test, "treasurer", memberships[0].Role)
+
+	err = organization.Delete(databaseConnection)
+	assert.NoError(test, err)
+
+	memberships, err = entity.LoadOrganizationMembershipsForAccount(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, 0, len(memberships))
+}
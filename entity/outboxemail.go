@@ -0,0 +1,178 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// OutboxPending is the status of an email that waits to be delivered, possibly after a failed attempt
+const OutboxPending = "pending"
+
+// OutboxSent is the status of an email that has been delivered
+const OutboxSent = "sent"
+
+// OutboxFailed is the status of an email that could not be delivered in as many attempts as were allowed, it stays in the outbox until it is retried
+const OutboxFailed = "failed"
+
+// OutboxEmail is a rendered email that waits to be, or has been, delivered, it is written in the same transaction as the change that it is about so that it is never lost if delivery fails, the bodies are never serialized since they may contain tokens and they are cleared once the email is sent
+type OutboxEmail struct {
+	ID            string     `json:"id" gorm:"primary_key;size:36"`
+	RealmID       string     `json:"-" gorm:"size:50;index"`
+	Template      string     `json:"template" gorm:"size:50"`
+	Recipient     string     `json:"to" gorm:"not null;size:100"`
+	Subject       string     `json:"subject" gorm:"size:1000"`
+	Body          string     `json:"-" gorm:"type:text"`
+	TextBody      string     `json:"-" gorm:"type:text"`
+	Status        string     `json:"status" gorm:"not null;size:20;index"`
+	Attempts      int        `json:"attempts"`
+	LastError     string     `json:"lastError,omitempty" gorm:"size:1000"`
+	NextAttemptAt *time.Time `json:"nextAttemptAt,omitempty" sql:"index"`
+	CreatedAt     *time.Time `json:"createdAt,omitempty"`
+	SentAt        *time.Time `json:"sentAt,omitempty"`
+}
+
+// BeforeSave will run before the struct is persisted with gorm
+func (email *OutboxEmail) BeforeSave() {
+	if email.ID == "" {
+		email.ID = uuid.Must(uuid.NewV4()).String()
+	}
+
+	if email.RealmID == "" {
+		email.RealmID = DefaultRealm
+	}
+
+	if email.Status == "" {
+		email.Status = OutboxPending
+	}
+
+	if email.NextAttemptAt == nil && email.Status == OutboxPending {
+		now := time.Now()
+		email.NextAttemptAt = &now
+	}
+}
+
+// IsValidOutboxStatus returns true if the status can be used to filter the outbox, an empty status means every email
+func IsValidOutboxStatus(status string) bool {
+	return status == "" || status == OutboxPending || status == OutboxSent || status == OutboxFailed
+}
+
+// Claim will reserve the email for a delivery attempt until the time, it counts the attempt and returns false if another replica has already claimed it
+func (email *OutboxEmail) Claim(databaseConnection *gorm.DB, until time.Time) (claimed bool, err error) {
+	result := databaseConnection.
+		Model(&OutboxEmail{}).
+		Where("id = ? AND status = ? AND attempts = ?", email.ID, OutboxPending, email.Attempts).
+		UpdateColumns(map[string]interface{}{"attempts": email.Attempts + 1, "next_attempt_at": until})
+	if result.Error != nil {
+		err = result.Error
+		return
+	}
+
+	claimed = result.RowsAffected > 0
+	if claimed {
+		email.Attempts++
+		email.NextAttemptAt = &until
+	}
+
+	return
+}
+
+// MarkSent will persist that the email has been delivered and clear its bodies
+func (email *OutboxEmail) MarkSent(databaseConnection *gorm.DB) (err error) {
+	now := time.Now()
+	err = databaseConnection.Model(&OutboxEmail{}).Where("id = ?", email.ID).UpdateColumns(map[string]interface{}{
+		"status":          OutboxSent,
+		"body":            "",
+		"text_body":       "",
+		"last_error":      "",
+		"next_attempt_at": nil,
+		"sent_at":         now,
+	}).Error
+	if err == nil {
+		email.Status = OutboxSent
+		email.Body = ""
+		email.TextBody = ""
+		email.LastError = ""
+		email.NextAttemptAt = nil
+		email.SentAt = &now
+	}
+
+	return
+}
+
+// MarkAttemptFailed will persist why the delivery failed, the email is attempted again at the time or, if it is nil, marked as failed
+func (email *OutboxEmail) MarkAttemptFailed(databaseConnection *gorm.DB, reason string, nextAttemptAt *time.Time) (err error) {
+	if len(reason) > 1000 {
+		reason = reason[:1000]
+	}
+
+	status := OutboxPending
+	if nextAttemptAt == nil {
+		status = OutboxFailed
+	}
+
+	err = databaseConnection.Model(&OutboxEmail{}).Where("id = ?", email.ID).UpdateColumns(map[string]interface{}{
+		"status":          status,
+		"last_error":      reason,
+		"next_attempt_at": nextAttemptAt,
+	}).Error
+	if err == nil {
+		email.Status = status
+		email.LastError = reason
+		email.NextAttemptAt = nextAttemptAt
+	}
+
+	return
+}
+
+// Retry will put a failed email back in the outbox with a fresh set of attempts, it returns false if the email had not failed
+func (email *OutboxEmail) Retry(databaseConnection *gorm.DB) (retried bool, err error) {
+	now := time.Now()
+	result := databaseConnection.
+		Model(&OutboxEmail{}).
+		Where("id = ? AND status = ?", email.ID, OutboxFailed).
+		UpdateColumns(map[string]interface{}{"status": OutboxPending, "attempts": 0, "next_attempt_at": now})
+	if result.Error != nil {
+		err = result.Error
+		return
+	}
+
+	retried = result.RowsAffected > 0
+	if retried {
+		email.Status = OutboxPending
+		email.Attempts = 0
+		email.NextAttemptAt = &now
+	}
+
+	return
+}
+
+// LoadDueOutboxEmails will fetch at most limit pending emails that should be attempted at or before the time, the ones that have waited the longest first
+func LoadDueOutboxEmails(databaseConnection *gorm.DB, now time.Time, limit int) (emails []OutboxEmail, err error) {
+	err = databaseConnection.Where("status = ? AND next_attempt_at <= ?", OutboxPending, now).Order("next_attempt_at").Limit(limit).Find(&emails).Error
+	return
+}
+
+// LoadOutboxEmails will fetch the emails with the status, or all of them if the status is empty, the latest first
+func LoadOutboxEmails(databaseConnection *gorm.DB, status string) (emails []OutboxEmail, err error) {
+	query := databaseConnection.Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	err = query.Find(&emails).Error
+	return
+}
+
+// LoadOutboxEmailFromID will fetch the email by id
+func LoadOutboxEmailFromID(databaseConnection *gorm.DB, id string) (email OutboxEmail, err error) {
+	err = databaseConnection.Where("id = ?", id).First(&email).Error
+	return
+}
+
+// PurgeSentOutboxEmails will permanently remove the emails that were sent before the time
+func PurgeSentOutboxEmails(databaseConnection *gorm.DB, sentBefore time.Time) (int, error) {
+	result := databaseConnection.Where("status = ? AND sent_at < ?", OutboxSent, sentBefore).Delete(&OutboxEmail{})
+	return int(result.RowsAffected), result.Error
+}
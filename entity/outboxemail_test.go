@@ -0,0 +1,113 @@
+package entity_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutboxEmailDelivery(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	email := entity.OutboxEmail{Template: "reset-password", Recipient: "user@example.com", Subject: "Password reset", Body: "secret link"}
+	err = databaseConnection.Create(&email).Error
+	assert.NoError(test, err)
+	assert.Equal(test, entity.OutboxPending, email.Status)
+	assert.Equal(test, entity.DefaultRealm, email.RealmID)
+
+	due, err := entity.LoadDueOutboxEmails(databaseConnection, time.Now(), 10)
+	assert.NoError(test, err)
+	assert.Equal(test, 1, len(due))
+
+	claimed, err := due[0].Claim(databaseConnection, time.Now().Add(time.Minute))
+	assert.NoError(test, err)
+	assert.True(test, claimed)
+	assert.Equal(test, 1, due[0].Attempts)
+
+	// Another replica that loaded the email before it was claimed cannot claim it as well
+	claimed, err = email.Claim(databaseConnection, time.Now().Add(time.Minute))
+	assert.NoError(test, err)
+	assert.False(test, claimed)
+
+	due, err = entity.LoadDueOutboxEmails(databaseConnection, time.Now(), 10)
+	assert.NoError(test, err)
+	assert.Equal(test, 0, len(due))
+
+	loadedEmail, err := entity.LoadOutboxEmailFromID(databaseConnection, email.ID)
+	assert.NoError(test, err)
+
+	err = loadedEmail.MarkSent(databaseConnection)
+	assert.NoError(test, err)
+
+	loadedEmail, err = entity.LoadOutboxEmailFromID(databaseConnection, email.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, entity.OutboxSent, loadedEmail.Status)
+	assert.Equal(test, "", loadedEmail.Body)
+	assert.NotNil(test, loadedEmail.SentAt)
+
+	purged, err := entity.PurgeSentOutboxEmails(databaseConnection, time.Now().Add(time.Minute))
+	assert.NoError(test, err)
+	assert.Equal(test, 1, purged)
+}
+
+func TestOutboxEmailFailureAndRetry(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	email := entity.OutboxEmail{Template: "new-account", Recipient: "user@example.com", Subject: "Your new account", Body: "invitation link"}
+	err = databaseConnection.Create(&email).Error
+	assert.NoError(test, err)
+
+	retried, err := email.Retry(databaseConnection)
+	assert.NoError(test, err)
+	assert.False(test, retried)
+
+	claimed, err := email.Claim(databaseConnection, time.Now().Add(time.Minute))
+	assert.NoError(test, err)
+	assert.True(test, claimed)
+
+	nextAttemptAt := time.Now().Add(-time.Second)
+	err = email.MarkAttemptFailed(databaseConnection, "connection refused", &nextAttemptAt)
+	assert.NoError(test, err)
+
+	due, err := entity.LoadDueOutboxEmails(databaseConnection, time.Now(), 10)
+	assert.NoError(test, err)
+	assert.Equal(test, 1, len(due))
+	assert.Equal(test, "connection refused", due[0].LastError)
+
+	claimed, err = email.Claim(databaseConnection, time.Now().Add(time.Minute))
+	assert.NoError(test, err)
+	assert.True(test, claimed)
+	assert.Equal(test, 2, email.Attempts)
+
+	err = email.MarkAttemptFailed(databaseConnection, "connection refused", nil)
+	assert.NoError(test, err)
+
+	failed, err := entity.LoadOutboxEmails(databaseConnection, entity.OutboxFailed)
+	assert.NoError(test, err)
+	assert.Equal(test, 1, len(failed))
+	assert.Equal(test, "invitation link", failed[0].Body)
+
+	retried, err = email.Retry(databaseConnection)
+	assert.NoError(test, err)
+	assert.True(test, retried)
+
+	due, err = entity.LoadDueOutboxEmails(databaseConnection, time.Now().Add(time.Second), 10)
+	assert.NoError(test, err)
+	assert.Equal(test, 1, len(due))
+	assert.Equal(test, 0, due[0].Attempts)
+}
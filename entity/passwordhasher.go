@@ -0,0 +1,207 @@
+package entity
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrPasswordMismatch is returned when a password does not match a hash
+var ErrPasswordMismatch = errors.New("The password does not match the hash")
+
+// ErrUnknownPasswordHash is returned when a hash was not made by any of the known algorithms
+var ErrUnknownPasswordHash = errors.New("The hash was not made by a known password hashing algorithm")
+
+// PasswordHasher hashes passwords into PHC formatted strings (https://github.com/P-H-C/phc-string-format) and verifies them
+type PasswordHasher interface {
+	// Hash returns a PHC formatted hash of the password with a new random salt
+	Hash(password string) (string, error)
+	// Handles returns true if the hash was made with the algorithm of the hasher, whatever parameters it used
+	Handles(hash string) bool
+	// Verify returns ErrPasswordMismatch if the password does not match the hash
+	Verify(hash string, password string) error
+	// NeedsRehash returns true if the hash was not made with the algorithm and the parameters of the hasher
+	NeedsRehash(hash string) bool
+}
+
+// PasswordHashing is the hasher that new passwords and reset tokens are hashed with, hashes made by another hasher can still be verified and passwords are rehashed with this hasher when they are used to log in
+var PasswordHashing PasswordHasher = DefaultArgon2idHasher()
+
+// knownPasswordHashers are used to verify hashes that were not made by PasswordHashing, they read the parameters from the hash itself
+var knownPasswordHashers = []PasswordHasher{&Argon2idHasher{}, &BcryptHasher{}}
+
+// comparePasswordHash returns nil if the password matches the hash regardless of which known algorithm that made it
+func comparePasswordHash(hash string, password string) error {
+	for _, hasher := range append([]PasswordHasher{PasswordHashing}, knownPasswordHashers...) {
+		if hasher.Handles(hash) {
+			return hasher.Verify(hash, password)
+		}
+	}
+
+	return ErrUnknownPasswordHash
+}
+
+// Argon2idHasher hashes passwords with argon2id, memory is in KiB
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2idHasher returns an argon2id hasher with the parameters that are used unless others are configured
+func DefaultArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32}
+}
+
+// argon2idHash is the parts of a PHC formatted argon2id hash
+type argon2idHash struct {
+	version     int
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func parseArgon2idHash(hash string) (parsed argon2idHash, err error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		err = ErrUnknownPasswordHash
+		return
+	}
+
+	_, err = fmt.Sscanf(parts[2], "v=%d", &parsed.version)
+	if err != nil {
+		return
+	}
+
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &parsed.memory, &parsed.iterations, &parsed.parallelism)
+	if err != nil {
+		return
+	}
+
+	parsed.salt, err = base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return
+	}
+
+	parsed.key, err = base64.RawStdEncoding.DecodeString(parts[5])
+	if err == nil && (len(parsed.salt) == 0 || len(parsed.key) == 0) {
+		err = ErrUnknownPasswordHash
+	}
+
+	return
+}
+
+// Hash returns a hash on the form $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func (hasher *Argon2idHasher) Hash(password string) (hash string, err error) {
+	salt := make([]byte, hasher.SaltLength)
+	_, err = rand.Read(salt)
+	if err != nil {
+		return
+	}
+
+	key := argon2.IDKey([]byte(password), salt, hasher.Iterations, hasher.Memory, hasher.Parallelism, hasher.KeyLength)
+
+	hash = fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		hasher.Memory,
+		hasher.Iterations,
+		hasher.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+	return
+}
+
+// Handles returns true for argon2id hashes
+func (hasher *Argon2idHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+// Verify hashes the password with the salt and parameters of the hash and compares the result in constant time
+func (hasher *Argon2idHasher) Verify(hash string, password string) error {
+	parsed, err := parseArgon2idHash(hash)
+	if err != nil {
+		return err
+	}
+
+	if parsed.version != argon2.Version {
+		return ErrUnknownPasswordHash
+	}
+
+	key := argon2.IDKey([]byte(password), parsed.salt, parsed.iterations, parsed.memory, parsed.parallelism, uint32(len(parsed.key)))
+	if subtle.ConstantTimeCompare(key, parsed.key) != 1 {
+		return ErrPasswordMismatch
+	}
+
+	return nil
+}
+
+// NeedsRehash returns true if the hash is not an argon2id hash with the same parameters as the hasher
+func (hasher *Argon2idHasher) NeedsRehash(hash string) bool {
+	parsed, err := parseArgon2idHash(hash)
+	if err != nil {
+		return true
+	}
+
+	return parsed.version != argon2.Version ||
+		parsed.memory != hasher.Memory ||
+		parsed.iterations != hasher.Iterations ||
+		parsed.parallelism != hasher.Parallelism ||
+		uint32(len(parsed.salt)) != hasher.SaltLength ||
+		uint32(len(parsed.key)) != hasher.KeyLength
+}
+
+// BcryptHasher hashes passwords with bcrypt, the modular crypt format that bcrypt uses ($2a$10$...) is already PHC compatible, a cost of 0 means bcrypt.DefaultCost
+type BcryptHasher struct {
+	Cost int
+}
+
+func (hasher *BcryptHasher) cost() int {
+	if hasher.Cost == 0 {
+		return bcrypt.DefaultCost
+	}
+
+	return hasher.Cost
+}
+
+// Hash returns a bcrypt hash of the password, bcrypt ignores everything after the first 72 bytes
+func (hasher *BcryptHasher) Hash(password string) (hash string, err error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), hasher.cost())
+	if err == nil {
+		hash = string(bytes)
+	}
+
+	return
+}
+
+// Handles returns true for bcrypt hashes
+func (hasher *BcryptHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// Verify compares the password with the hash
+func (hasher *BcryptHasher) Verify(hash string, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return ErrPasswordMismatch
+	}
+
+	return err
+}
+
+// NeedsRehash returns true if the hash is not a bcrypt hash with the cost of the hasher
+func (hasher *BcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost != hasher.cost()
+}
@@ -0,0 +1,82 @@
+package entity_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArgon2idHasher(test *testing.T) {
+	hasher := entity.DefaultArgon2idHasher()
+
+	hash, err := hasher.Hash("mysecretpassword")
+	assert.NoError(test, err)
+	assert.True(test, strings.HasPrefix(hash, "$argon2id$v=19$m=65536,t=3,p=2$"))
+	assert.True(test, hasher.Handles(hash))
+	assert.False(test, hasher.NeedsRehash(hash))
+
+	assert.NoError(test, hasher.Verify(hash, "mysecretpassword"))
+	assert.Equal(test, entity.ErrPasswordMismatch, hasher.Verify(hash, "invalidpassword"))
+
+	otherHash, err := hasher.Hash("mysecretpassword")
+	assert.NoError(test, err)
+	assert.NotEqual(test, hash, otherHash)
+
+	stronger := entity.DefaultArgon2idHasher()
+	stronger.Iterations = 4
+	assert.True(test, stronger.NeedsRehash(hash))
+	assert.NoError(test, stronger.Verify(hash, "mysecretpassword"))
+}
+
+func TestBcryptHasher(test *testing.T) {
+	hasher := &entity.BcryptHasher{}
+
+	hash, err := hasher.Hash("mysecretpassword")
+	assert.NoError(test, err)
+	assert.True(test, strings.HasPrefix(hash, "$2a$10$"))
+	assert.True(test, hasher.Handles(hash))
+	assert.False(test, hasher.NeedsRehash(hash))
+	assert.True(test, entity.DefaultArgon2idHasher().NeedsRehash(hash))
+
+	assert.NoError(test, hasher.Verify(hash, "mysecretpassword"))
+	assert.Equal(test, entity.ErrPasswordMismatch, hasher.Verify(hash, "invalidpassword"))
+
+	assert.True(test, (&entity.BcryptHasher{Cost: 11}).NeedsRehash(hash))
+}
+
+func TestAccountCompareHashedPasswordAgainstWithUnknownHash(test *testing.T) {
+	account := entity.Account{Password: "plaintext"}
+	assert.Equal(test, entity.ErrUnknownPasswordHash, account.CompareHashedPasswordAgainst("plaintext"))
+}
+
+func TestAccountLoadAccountFromEmailAndPasswordRehashesOutdatedHash(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	bcryptHash, err := (&entity.BcryptHasher{}).Hash("mysecretpassword")
+	assert.NoError(test, err)
+
+	account := entity.Account{ID: uuid.Must(uuid.NewV4()).String(), Email: "user@example.com", Password: bcryptHash}
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	_, err = entity.LoadAccountFromEmailAndPassword(databaseConnection, account.Email, "mysecretpassword")
+	assert.NoError(test, err)
+
+	loadedAccount, err := entity.LoadAccountFromID(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.True(test, strings.HasPrefix(loadedAccount.Password, "$argon2id$"))
+	assert.False(test, entity.PasswordHashing.NeedsRehash(loadedAccount.Password))
+
+	_, err = entity.LoadAccountFromEmailAndPassword(databaseConnection, account.Email, "mysecretpassword")
+	assert.NoError(test, err)
+}
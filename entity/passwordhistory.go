@@ -0,0 +1,85 @@
+package entity
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// PasswordHistoryEntry is the hash of a password that an account had before it was changed, it is kept so that the password cannot be chosen again
+type PasswordHistoryEntry struct {
+	ID        string     `json:"-" gorm:"primary_key;size:36"`
+	AccountID string     `json:"-" gorm:"not null;size:36;index"`
+	Hash      string     `json:"-" gorm:"not null"`
+	CreatedAt *time.Time `json:"-" sql:"index"`
+}
+
+// BeforeSave will run before the struct is persisted with gorm
+func (entry *PasswordHistoryEntry) BeforeSave() {
+	if entry.ID == "" {
+		entry.ID = uuid.Must(uuid.NewV4()).String()
+	}
+}
+
+// IsPasswordReused returns true if the password is the current password of the account or one of its previous passwords, size is how many passwords (the current one included) that are remembered and 0 means that passwords may be reused
+func (account *Account) IsPasswordReused(databaseConnection *gorm.DB, password string, size int) (reused bool, err error) {
+	if size <= 0 {
+		return
+	}
+
+	if account.Password != "" && account.CompareHashedPasswordAgainst(password) == nil {
+		reused = true
+		return
+	}
+
+	if size == 1 {
+		return
+	}
+
+	var entries []PasswordHistoryEntry
+	err = databaseConnection.Where("account_id = ?", account.ID).Order("created_at desc").Limit(size - 1).Find(&entries).Error
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if comparePasswordHash(entry.Hash, password) == nil {
+			reused = true
+			return
+		}
+	}
+
+	return
+}
+
+// RememberPreviousPassword will store the hash of a password that the account no longer has and remove the oldest ones so that size passwords, the current one included, are remembered, nothing is stored if size is 0, the caller runs it in a transaction since it makes more than one change
+func RememberPreviousPassword(databaseConnection *gorm.DB, accountID string, hash string, size int) (err error) {
+	if hash == "" || size <= 0 {
+		return
+	}
+
+	if size > 1 {
+		err = databaseConnection.Create(&PasswordHistoryEntry{AccountID: accountID, Hash: hash}).Error
+		if err != nil {
+			return
+		}
+	}
+
+	var entries []PasswordHistoryEntry
+	err = databaseConnection.Where("account_id = ?", accountID).Order("created_at desc").Find(&entries).Error
+	if err != nil {
+		return
+	}
+
+	if len(entries) > size-1 {
+		var ids []string
+		for _, entry := range entries[size-1:] {
+			ids = append(ids, entry.ID)
+		}
+
+		err = databaseConnection.Where("id IN (?)", ids).Delete(&PasswordHistoryEntry{}).Error
+	}
+
+	return
+}
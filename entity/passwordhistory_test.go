@@ -0,0 +1,66 @@
+package entity_test
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func changePassword(test *testing.T, databaseConnection *gorm.DB, account *entity.Account, password string, size int) {
+	previousHash := account.Password
+	err := account.SetPassword(password)
+	assert.NoError(test, err)
+
+	err = databaseConnection.Model(account).UpdateColumn("password", account.Password).Error
+	assert.NoError(test, err)
+
+	err = entity.RememberPreviousPassword(databaseConnection, account.ID, previousHash, size)
+	assert.NoError(test, err)
+}
+
+func TestAccountIsPasswordReused(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	account := entity.Account{Email: "user@example.com"}
+	account.SetPassword("first password")
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	changePassword(test, databaseConnection, &account, "second password", 3)
+	changePassword(test, databaseConnection, &account, "third password", 3)
+	changePassword(test, databaseConnection, &account, "fourth password", 3)
+
+	var remembered int
+	err = databaseConnection.Model(&entity.PasswordHistoryEntry{}).Where("account_id = ?", account.ID).Count(&remembered).Error
+	assert.NoError(test, err)
+	assert.Equal(test, 2, remembered)
+
+	for password, expected := range map[string]bool{
+		"first password":  false,
+		"second password": true,
+		"third password":  true,
+		"fourth password": true,
+		"fifth password":  false,
+	} {
+		reused, err := account.IsPasswordReused(databaseConnection, password, 3)
+		assert.NoError(test, err)
+		assert.Equal(test, expected, reused, password)
+	}
+
+	reused, err := account.IsPasswordReused(databaseConnection, "fourth password", 0)
+	assert.NoError(test, err)
+	assert.False(test, reused)
+
+	reused, err = account.IsPasswordReused(databaseConnection, "third password", 1)
+	assert.NoError(test, err)
+	assert.False(test, reused)
+}
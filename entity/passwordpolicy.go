@@ -0,0 +1,125 @@
+package entity
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// MaximumPasswordBytes is the longest password that bcrypt can hash, the rest of a longer password would be ignored
+const MaximumPasswordBytes = 72
+
+// PasswordPolicy is the rules that a new password has to satisfy, History is how many of the latest passwords of an account (the current one included) that cannot be chosen again when resetting or changing the password and 0 allows reuse, MaximumAge is how long a password may be used before it has to be changed and 0 means forever
+type PasswordPolicy struct {
+	MinimumLength     int
+	MaximumLength     int
+	RequireLowercase  bool
+	RequireUppercase  bool
+	RequireDigit      bool
+	RequireSymbol     bool
+	RejectEmail       bool
+	BreachedPasswords *BreachedPasswordList
+	History           int
+	MaximumAge        time.Duration
+}
+
+// PasswordViolation describes a rule of the password policy that a password does not satisfy, the rule is meant for clients and the message for people
+type PasswordViolation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	Limit   int    `json:"limit,omitempty"`
+}
+
+// DefaultPasswordPolicy returns the policy that is used unless another one is configured
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{MinimumLength: 10, MaximumLength: MaximumPasswordBytes, RejectEmail: true, History: 5}
+}
+
+// Check returns every rule of the policy that the password of the account with the email does not satisfy, err is set if the breached password list could not be read and then the password is checked against the other rules only
+func (policy PasswordPolicy) Check(password string, email string) (violations []PasswordViolation, err error) {
+	violations = []PasswordViolation{}
+
+	length := len([]rune(password))
+	if length < policy.MinimumLength {
+		violations = append(violations, PasswordViolation{
+			Rule:    "minimum-length",
+			Message: fmt.Sprintf("The password must be at least %d characters", policy.MinimumLength),
+			Limit:   policy.MinimumLength,
+		})
+	}
+
+	maximumLength := policy.MaximumLength
+	if maximumLength <= 0 || maximumLength > MaximumPasswordBytes {
+		maximumLength = MaximumPasswordBytes
+	}
+	if len(password) > maximumLength {
+		violations = append(violations, PasswordViolation{
+			Rule:    "maximum-length",
+			Message: fmt.Sprintf("The password may be at most %d bytes", maximumLength),
+			Limit:   maximumLength,
+		})
+	}
+
+	var hasLowercase, hasUppercase, hasDigit, hasSymbol bool
+	for _, character := range password {
+		switch {
+		case unicode.IsLower(character):
+			hasLowercase = true
+		case unicode.IsUpper(character):
+			hasUppercase = true
+		case unicode.IsDigit(character):
+			hasDigit = true
+		case unicode.IsPunct(character) || unicode.IsSymbol(character) || unicode.IsSpace(character):
+			hasSymbol = true
+		}
+	}
+
+	if policy.RequireLowercase && !hasLowercase {
+		violations = append(violations, PasswordViolation{Rule: "lowercase", Message: "The password must contain a lowercase letter"})
+	}
+	if policy.RequireUppercase && !hasUppercase {
+		violations = append(violations, PasswordViolation{Rule: "uppercase", Message: "The password must contain an uppercase letter"})
+	}
+	if policy.RequireDigit && !hasDigit {
+		violations = append(violations, PasswordViolation{Rule: "digit", Message: "The password must contain a digit"})
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		violations = append(violations, PasswordViolation{Rule: "symbol", Message: "The password must contain a symbol"})
+	}
+
+	if policy.RejectEmail && containsEmail(password, email) {
+		violations = append(violations, PasswordViolation{Rule: "contains-email", Message: "The password must not contain the email of the account"})
+	}
+
+	// A list that cannot be read should not stop anyone from choosing a password so the error is returned for the caller to report instead of being a violation
+	if policy.BreachedPasswords != nil {
+		var breached bool
+		breached, err = policy.BreachedPasswords.Contains(password)
+		if err == nil && breached {
+			violations = append(violations, PasswordViolation{Rule: "breached", Message: "The password is known from a data breach, choose another one"})
+		}
+	}
+
+	return
+}
+
+// containsEmail returns true if the password contains the email or the part of it before the @ (if that part is long enough to be meaningful)
+func containsEmail(password string, email string) bool {
+	password = strings.ToLower(password)
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+
+	if strings.Contains(password, email) {
+		return true
+	}
+
+	localPart := email
+	if at := strings.Index(email, "@"); at >= 0 {
+		localPart = email[:at]
+	}
+
+	return len(localPart) >= 3 && strings.Contains(password, localPart)
+}
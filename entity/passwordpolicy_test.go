@@ -0,0 +1,48 @@
+package entity_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+// rules returns the rules of the violations or nil if the check failed
+func rules(violations []entity.PasswordViolation, err error) (names []string) {
+	if err != nil {
+		return
+	}
+
+	names = []string{}
+	for _, violation := range violations {
+		names = append(names, violation.Rule)
+	}
+
+	return
+}
+
+func TestPasswordPolicyCheck(test *testing.T) {
+	policy := entity.DefaultPasswordPolicy()
+
+	assert.Equal(test, []string{}, rules(policy.Check("correct horse battery", "user@example.com")))
+	assert.Equal(test, []string{"minimum-length"}, rules(policy.Check("a", "user@example.com")))
+	assert.Equal(test, []string{"maximum-length"}, rules(policy.Check(strings.Repeat("a", 73), "user@example.com")))
+	assert.Equal(test, []string{"contains-email"}, rules(policy.Check("MyUser2018!", "user@example.com")))
+}
+
+func TestPasswordPolicyCheckCharacterClasses(test *testing.T) {
+	policy := entity.PasswordPolicy{RequireLowercase: true, RequireUppercase: true, RequireDigit: true, RequireSymbol: true}
+
+	assert.Equal(test, []string{"uppercase", "digit", "symbol"}, rules(policy.Check("abcdefghij", "")))
+	assert.Equal(test, []string{}, rules(policy.Check("Abcdefgh1!", "")))
+}
+
+func TestPasswordPolicyCheckLimitsMaximumLengthToBcrypt(test *testing.T) {
+	policy := entity.PasswordPolicy{MaximumLength: 100}
+
+	violations, err := policy.Check(strings.Repeat("å", 40), "")
+	assert.NoError(test, err)
+	assert.Equal(test, []string{"maximum-length"}, rules(violations, err))
+	assert.Equal(test, entity.MaximumPasswordBytes, violations[0].Limit)
+}
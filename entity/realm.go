@@ -0,0 +1,173 @@
+package entity
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// DefaultRealm is the name of the realm that is used when a request does not specify any realm, it is signed with the private key that the service was configured with
+const DefaultRealm = "default"
+
+// ErrInvalidRealmName is returned when a realm name is not a lower case slug
+var ErrInvalidRealmName = errors.New("The realm name may only contain lower case letters, digits and dashes")
+
+var realmNamePattern = regexp.MustCompile("^[a-z0-9][a-z0-9-]{0,49}$")
+
+// Realm represents an independent organisation with its own accounts, roles, groups, email templates and signing key
+type Realm struct {
+	Name           string               `json:"name" gorm:"primary_key;size:50" validate:"required,max=50"`
+	Host           string               `json:"host" gorm:"size:255;index" validate:"omitempty,max=255,hostname"`
+	PrivateKey     string               `json:"-" gorm:"type:text"`
+	EmailTemplates []RealmEmailTemplate `json:"emailTemplates" gorm:"-" validate:"dive"`
+	Registration   *RealmRegistration   `json:"registration,omitempty" gorm:"-"`
+}
+
+// RealmEmailTemplate overrides one of the services email templates for a realm, in one locale or, if the locale is empty, in every locale that the realm has no own version for, the body is HTML and the text is the plain text version of it, the email has no plain text version if the text is empty
+type RealmEmailTemplate struct {
+	RealmName string     `json:"-" gorm:"primary_key;size:50"`
+	Name      string     `json:"name" gorm:"primary_key;size:50" validate:"required,max=50"`
+	Locale    string     `json:"locale,omitempty" gorm:"primary_key;size:35;not null;default:''" validate:"max=35"`
+	Subject   string     `json:"subject" gorm:"size:255" validate:"max=255"`
+	Body      string     `json:"body" gorm:"type:text"`
+	Text      string     `json:"text,omitempty" gorm:"type:text"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// RealmRegistration is the self-registration settings of a realm, the lists are stored comma separated
+type RealmRegistration struct {
+	RealmName                string   `json:"-" gorm:"primary_key;size:50"`
+	Enabled                  bool     `json:"enabled"`
+	RequireApproval          bool     `json:"requireApproval"`
+	AllowedDomains           []string `json:"allowedDomains" gorm:"-" validate:"dive,required,max=255,excludesall=0x2C"`
+	DeniedDomains            []string `json:"deniedDomains" gorm:"-" validate:"dive,required,max=255,excludesall=0x2C"`
+	DefaultRoles             []string `json:"defaultRoles" gorm:"-" validate:"dive,required,max=50,excludesall=0x2C"`
+	AllowedDomainsSerialized string   `json:"-" gorm:"type:text"`
+	DeniedDomainsSerialized  string   `json:"-" gorm:"type:text"`
+	DefaultRolesSerialized   string   `json:"-" gorm:"type:text"`
+}
+
+// BeforeSave will run before the struct is persisted with gorm
+func (registration *RealmRegistration) BeforeSave() {
+	registration.AllowedDomainsSerialized = strings.Join(uniqueStrings(registration.AllowedDomains), ",")
+	registration.DeniedDomainsSerialized = strings.Join(uniqueStrings(registration.DeniedDomains), ",")
+	registration.DefaultRolesSerialized = strings.Join(uniqueStrings(registration.DefaultRoles), ",")
+}
+
+// AfterFind will run after the struct has been read from persistence
+func (registration *RealmRegistration) AfterFind() {
+	registration.AllowedDomains = splitSerializedList(registration.AllowedDomainsSerialized)
+	registration.DeniedDomains = splitSerializedList(registration.DeniedDomainsSerialized)
+	registration.DefaultRoles = splitSerializedList(registration.DefaultRolesSerialized)
+}
+
+// splitSerializedList returns the values of a comma separated list, an empty list gives an empty slice
+func splitSerializedList(serialized string) []string {
+	values := uniqueStrings(strings.Split(serialized, ","))
+	if values == nil {
+		values = []string{}
+	}
+
+	return values
+}
+
+// IsValidRealmName returns true if the name can be used for a realm, the name is used in URLs so only lower case letters, digits and dashes are allowed
+func IsValidRealmName(name string) bool {
+	return realmNamePattern.MatchString(name)
+}
+
+// InRealm narrows a database connection to the entities of a realm
+func InRealm(databaseConnection *gorm.DB, realm string) *gorm.DB {
+	return databaseConnection.Where("realm_id = ?", realm)
+}
+
+// Issuer returns the iss claim for tokens that are issued by the realm
+func (realm *Realm) Issuer() string {
+	if realm.Name == DefaultRealm {
+		return "identity-provider"
+	}
+
+	return "identity-provider/realms/" + realm.Name
+}
+
+// AfterCreate will run after the struct has been persisted with gorm for the first time and stores the email templates that the realm was created with, after that they are changed one at a time
+func (realm *Realm) AfterCreate(databaseConnection *gorm.DB) (err error) {
+	for _, template := range realm.EmailTemplates {
+		template.RealmName = realm.Name
+		err = databaseConnection.Create(&template).Error
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// AfterSave will run after the struct has been persisted with gorm and saves the self-registration settings of the realm if they are set
+func (realm *Realm) AfterSave(databaseConnection *gorm.DB) (err error) {
+	if realm.Registration != nil {
+		realm.Registration.RealmName = realm.Name
+		err = databaseConnection.Save(realm.Registration).Error
+	}
+
+	return
+}
+
+// AfterFind will run after the struct has been read from persistence
+func (realm *Realm) AfterFind(databaseConnection *gorm.DB) (err error) {
+	err = databaseConnection.Where("realm_name = ?", realm.Name).Order("name, locale").Find(&realm.EmailTemplates).Error
+	if realm.EmailTemplates == nil {
+		realm.EmailTemplates = []RealmEmailTemplate{}
+	}
+	if err != nil {
+		return
+	}
+
+	registration := RealmRegistration{}
+	err = databaseConnection.Where("realm_name = ?", realm.Name).First(&registration).Error
+	if err == nil {
+		realm.Registration = &registration
+	} else if gorm.IsRecordNotFoundError(err) {
+		err = nil
+	}
+
+	return
+}
+
+// LoadRealms will fetch all realms ordered by name
+func LoadRealms(databaseConnection *gorm.DB) (realms []Realm, err error) {
+	err = databaseConnection.Order("name").Find(&realms).Error
+	return
+}
+
+// LoadRealmFromName will fetch the realm from the persistence
+func LoadRealmFromName(databaseConnection *gorm.DB, name string) (realm Realm, err error) {
+	err = databaseConnection.Where("name = ?", name).First(&realm).Error
+	return
+}
+
+// LoadRealmEmailTemplate will fetch the realms own version of the email template in the locale from the persistence, an empty locale is the version for every locale
+func LoadRealmEmailTemplate(databaseConnection *gorm.DB, realm string, name string, locale string) (template RealmEmailTemplate, err error) {
+	err = databaseConnection.Where("realm_name = ? AND name = ? AND locale = ?", realm, name, locale).First(&template).Error
+	return
+}
+
+// DeleteRealmEmailTemplate will remove the realms own version of the email template in the locale so that the next template in line is used again, it returns false if the realm did not have its own version
+func DeleteRealmEmailTemplate(databaseConnection *gorm.DB, realm string, name string, locale string) (deleted bool, err error) {
+	result := databaseConnection.Where("realm_name = ? AND name = ? AND locale = ?", realm, name, locale).Delete(&RealmEmailTemplate{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// SetupRealm will make sure that the realm has the built in roles and that the administrator role has all the permissions needed to manage the realm
+func SetupRealm(databaseConnection *gorm.DB, realm string) (err error) {
+	err = EnsureRoles(databaseConnection, realm, "user", "administrator")
+	if err != nil {
+		return
+	}
+
+	err = EnsureRolePermissions(databaseConnection, realm, "administrator", AdministratorPermissions...)
+	return
+}
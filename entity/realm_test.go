@@ -0,0 +1,168 @@
+package entity_test
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRealmIsValidRealmName(test *testing.T) {
+	assert.Equal(test, true, entity.IsValidRealmName("example-organisation"))
+	assert.Equal(test, false, entity.IsValidRealmName("Example"))
+	assert.Equal(test, false, entity.IsValidRealmName("-example"))
+	assert.Equal(test, false, entity.IsValidRealmName("example/organisation"))
+	assert.Equal(test, false, entity.IsValidRealmName(""))
+}
+
+func TestRealmIssuer(test *testing.T) {
+	defaultRealm := entity.Realm{Name: entity.DefaultRealm}
+	assert.Equal(test, "identity-provider", defaultRealm.Issuer())
+
+	realm := entity.Realm{Name: "example"}
+	assert.Equal(test, "identity-provider/realms/example", realm.Issuer())
+}
+
+func TestRealmAccountsAreSeparated(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	realm := entity.Realm{Name: "example", EmailTemplates: []entity.RealmEmailTemplate{{Name: "new-account", Subject: "Välkommen"}}}
+	err = databaseConnection.Create(&realm).Error
+	assert.NoError(test, err)
+
+	err = entity.SetupRealm(databaseConnection, realm.Name)
+	assert.NoError(test, err)
+
+	defaultAccount := entity.Account{Email: "user@example.com", Roles: []string{"user"}}
+	err = databaseConnection.Create(&defaultAccount).Error
+	assert.NoError(test, err)
+	assert.Equal(test, entity.DefaultRealm, defaultAccount.RealmID)
+
+	realmAccount := entity.Account{RealmID: "example", Email: "user@example.com", Roles: []string{"administrator"}}
+	err = databaseConnection.Create(&realmAccount).Error
+	assert.NoError(test, err)
+
+	loadedAccount, err := entity.LoadAccountFromEmail(entity.InRealm(databaseConnection, "example"), "user@example.com")
+	assert.NoError(test, err)
+	assert.Equal(test, realmAccount.ID, loadedAccount.ID)
+	assert.Equal(test, []string{"administrator"}, loadedAccount.Roles)
+
+	_, total, err := entity.LoadAccounts(entity.InRealm(databaseConnection, entity.DefaultRealm), entity.AccountQuery{Role: "administrator"})
+	assert.NoError(test, err)
+	assert.Equal(test, 0, total)
+
+	loadedRealm, err := entity.LoadRealmFromName(databaseConnection, "example")
+	assert.NoError(test, err)
+	assert.Equal(test, 1, len(loadedRealm.EmailTemplates))
+	assert.Equal(test, "Välkommen", loadedRealm.EmailTemplates[0].Subject)
+}
+
+func TestRealmEmailTemplateEditAndReset(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	_, err = entity.LoadRealmEmailTemplate(databaseConnection, entity.DefaultRealm, "reset-password", "")
+	assert.Error(test, err)
+
+	template := entity.RealmEmailTemplate{RealmName: entity.DefaultRealm, Name: "reset-password", Subject: "Password reset", Body: "First version"}
+	err = databaseConnection.Save(&template).Error
+	assert.NoError(test, err)
+
+	template.Body = "Second version"
+	err = databaseConnection.Save(&template).Error
+	assert.NoError(test, err)
+
+	swedishTemplate := entity.RealmEmailTemplate{RealmName: entity.DefaultRealm, Name: "reset-password", Locale: "sv", Subject: "Återställ lösenord", Body: "Svensk version", Text: "Svensk textversion"}
+	err = databaseConnection.Save(&swedishTemplate).Error
+	assert.NoError(test, err)
+
+	loadedTemplate, err := entity.LoadRealmEmailTemplate(databaseConnection, entity.DefaultRealm, "reset-password", "")
+	assert.NoError(test, err)
+	assert.Equal(test, "Second version", loadedTemplate.Body)
+	assert.NotNil(test, loadedTemplate.UpdatedAt)
+
+	loadedTemplate, err = entity.LoadRealmEmailTemplate(databaseConnection, entity.DefaultRealm, "reset-password", "sv")
+	assert.NoError(test, err)
+	assert.Equal(test, "Svensk version", loadedTemplate.Body)
+	assert.Equal(test, "Svensk textversion", loadedTemplate.Text)
+
+	_, err = entity.LoadRealmEmailTemplate(databaseConnection, entity.DefaultRealm, "reset-password", "en")
+	assert.Error(test, err)
+
+	_, err = entity.LoadRealmEmailTemplate(databaseConnection, "example", "reset-password", "")
+	assert.Error(test, err)
+
+	// Saving the realm, as PUT /realm/<name> does, keeps the templates that were edited one at a time
+	realm, err := entity.LoadRealmFromName(databaseConnection, entity.DefaultRealm)
+	assert.NoError(test, err)
+	realm.EmailTemplates = []entity.RealmEmailTemplate{}
+	err = databaseConnection.Save(&realm).Error
+	assert.NoError(test, err)
+
+	realm, err = entity.LoadRealmFromName(databaseConnection, entity.DefaultRealm)
+	assert.NoError(test, err)
+	assert.Equal(test, 2, len(realm.EmailTemplates))
+
+	deleted, err := entity.DeleteRealmEmailTemplate(databaseConnection, entity.DefaultRealm, "reset-password", "")
+	assert.NoError(test, err)
+	assert.True(test, deleted)
+
+	deleted, err = entity.DeleteRealmEmailTemplate(databaseConnection, entity.DefaultRealm, "reset-password", "")
+	assert.NoError(test, err)
+	assert.False(test, deleted)
+
+	_, err = entity.LoadRealmEmailTemplate(databaseConnection, entity.DefaultRealm, "reset-password", "sv")
+	assert.NoError(test, err)
+}
+
+func TestRealmRegistration(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	realm := entity.Realm{Name: "example"}
+	err = databaseConnection.Create(&realm).Error
+	assert.NoError(test, err)
+
+	loadedRealm, err := entity.LoadRealmFromName(databaseConnection, "example")
+	assert.NoError(test, err)
+	assert.Nil(test, loadedRealm.Registration)
+
+	loadedRealm.Registration = &entity.RealmRegistration{Enabled: true, AllowedDomains: []string{"example.com", "example.org"}}
+	err = databaseConnection.Save(&loadedRealm).Error
+	assert.NoError(test, err)
+
+	loadedRealm, err = entity.LoadRealmFromName(databaseConnection, "example")
+	assert.NoError(test, err)
+	assert.True(test, loadedRealm.Registration.Enabled)
+	assert.Equal(test, []string{"example.com", "example.org"}, loadedRealm.Registration.AllowedDomains)
+	assert.Equal(test, []string{}, loadedRealm.Registration.DefaultRoles)
+
+	// Saving the realm without registration settings keeps the ones it has
+	loadedRealm.Registration = nil
+	err = databaseConnection.Save(&loadedRealm).Error
+	assert.NoError(test, err)
+
+	loadedRealm, err = entity.LoadRealmFromName(databaseConnection, "example")
+	assert.NoError(test, err)
+	assert.True(test, loadedRealm.Registration.Enabled)
+
+	defaultRealm, err := entity.LoadRealmFromName(databaseConnection, entity.DefaultRealm)
+	assert.NoError(test, err)
+	assert.Nil(test, defaultRealm.Registration)
+}
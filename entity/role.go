@@ -0,0 +1,375 @@
+package entity
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrUnknownRole is returned when an account is given a role that does not exist
+var ErrUnknownRole = errors.New("One or more of the roles does not exist")
+
+// ErrInvalidRoleInclusion is returned when a role includes itself
+var ErrInvalidRoleInclusion = errors.New("A role cannot include itself")
+
+// AdministratorPermissions are the permissions that the administrator role always has, they guard the end points of this service
+var AdministratorPermissions = []string{"account:impersonate", "account:read", "account:write", "client:read", "client:write", "email:read", "email:write", "group:read", "group:write", "organization:read", "organization:write", "realm:read", "realm:write", "role:read", "role:write", "scope:read", "scope:write"}
+
+// Role represents a role that can be assigned to accounts, a role can include other roles and grant permissions
+type Role struct {
+	ID          string   `json:"id" gorm:"primary_key;size:36" validate:"uuid4,required"`
+	RealmID     string   `json:"-" gorm:"size:50;unique_index:idx_roles_realm_name"`
+	Name        string   `json:"name" gorm:"not null;size:50;unique_index:idx_roles_realm_name" validate:"required,max=50,excludesall=0x2C"`
+	Description string   `json:"description" gorm:"size:255" validate:"max=255"`
+	Includes    []string `json:"includes" gorm:"-"`
+	Permissions []string `json:"permissions" gorm:"-" validate:"dive,required,max=100,excludesall=0x2C"`
+}
+
+// AccountRole joins accounts with their roles
+type AccountRole struct {
+	AccountID string `gorm:"primary_key;size:36"`
+	RoleID    string `gorm:"primary_key;size:36;index"`
+}
+
+// RoleInclusion makes a role include all the roles and permissions of another role
+type RoleInclusion struct {
+	RoleID         string `gorm:"primary_key;size:36"`
+	IncludedRoleID string `gorm:"primary_key;size:36;index"`
+}
+
+// RolePermission grants a permission to a role
+type RolePermission struct {
+	RoleID     string `gorm:"primary_key;size:36"`
+	Permission string `gorm:"primary_key;size:100"`
+}
+
+// BeforeSave will run before the struct is persisted with gorm
+func (role *Role) BeforeSave() {
+	if role.ID == "" {
+		role.ID = uuid.Must(uuid.NewV4()).String()
+	}
+
+	if role.RealmID == "" {
+		role.RealmID = DefaultRealm
+	}
+}
+
+// AfterSave will run after the struct has been persisted with gorm and replaces the included roles and permissions
+func (role *Role) AfterSave(databaseConnection *gorm.DB) (err error) {
+	includedRoles, err := LoadRolesFromNames(InRealm(databaseConnection, role.RealmID), role.Includes)
+	if err != nil {
+		return
+	}
+
+	err = databaseConnection.Where("role_id = ?", role.ID).Delete(&RoleInclusion{}).Error
+	if err != nil {
+		return
+	}
+
+	for _, includedRole := range includedRoles {
+		if includedRole.ID == role.ID {
+			return ErrInvalidRoleInclusion
+		}
+
+		err = databaseConnection.Create(&RoleInclusion{RoleID: role.ID, IncludedRoleID: includedRole.ID}).Error
+		if err != nil {
+			return
+		}
+	}
+
+	err = databaseConnection.Where("role_id = ?", role.ID).Delete(&RolePermission{}).Error
+	if err != nil {
+		return
+	}
+
+	for _, permission := range uniqueStrings(role.Permissions) {
+		err = databaseConnection.Create(&RolePermission{RoleID: role.ID, Permission: permission}).Error
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// AfterFind will run after the struct has been read from persistence
+func (role *Role) AfterFind(databaseConnection *gorm.DB) (err error) {
+	err = databaseConnection.
+		Table("roles").
+		Joins("JOIN role_inclusions ON role_inclusions.included_role_id = roles.id").
+		Where("role_inclusions.role_id = ?", role.ID).
+		Order("roles.name").
+		Pluck("roles.name", &role.Includes).
+		Error
+	if err != nil {
+		return
+	}
+
+	err = databaseConnection.Model(&RolePermission{}).Where("role_id = ?", role.ID).Order("permission").Pluck("permission", &role.Permissions).Error
+
+	if role.Includes == nil {
+		role.Includes = []string{}
+	}
+	if role.Permissions == nil {
+		role.Permissions = []string{}
+	}
+
+	return
+}
+
+// LoadRoles will fetch all roles ordered by name
+func LoadRoles(databaseConnection *gorm.DB) (roles []Role, err error) {
+	err = databaseConnection.Order("name").Find(&roles).Error
+	return
+}
+
+// LoadRoleFromID will fetch the role from the persistence
+func LoadRoleFromID(databaseConnection *gorm.DB, id string) (role Role, err error) {
+	err = databaseConnection.Where("id = ?", id).First(&role).Error
+	return
+}
+
+// LoadRolesFromNames will fetch the roles with the given names, ErrUnknownRole is returned if any of them does not exist
+func LoadRolesFromNames(databaseConnection *gorm.DB, names []string) (roles []Role, err error) {
+	unique := uniqueStrings(names)
+	if len(unique) == 0 {
+		return
+	}
+
+	err = databaseConnection.Where("name IN (?)", unique).Find(&roles).Error
+	if err == nil && len(roles) != len(unique) {
+		err = ErrUnknownRole
+	}
+
+	return
+}
+
+// EnsureRoles will create the roles with the given names in the realm unless they already exist
+func EnsureRoles(databaseConnection *gorm.DB, realm string, names ...string) (err error) {
+	for _, name := range uniqueStrings(names) {
+		// FirstOrCreate cannot be used since gorm decides which columns to insert before BeforeSave has set the id
+		err = databaseConnection.Where(Role{RealmID: realm, Name: name}).First(&Role{}).Error
+		if err == nil {
+			continue
+		}
+		if !gorm.IsRecordNotFoundError(err) {
+			return
+		}
+
+		err = databaseConnection.Create(&Role{RealmID: realm, Name: name}).Error
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// EnsureRolePermissions will grant the permissions to the role with the given name in the realm unless it already has them
+func EnsureRolePermissions(databaseConnection *gorm.DB, realm string, name string, permissions ...string) (err error) {
+	role := Role{}
+	err = InRealm(databaseConnection, realm).Where("name = ?", name).First(&role).Error
+	if err != nil {
+		return
+	}
+
+	for _, permission := range uniqueStrings(permissions) {
+		err = databaseConnection.Where(RolePermission{RoleID: role.ID, Permission: permission}).FirstOrCreate(&RolePermission{}).Error
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// LoadEffectiveRolesAndPermissions will expand the role names with every role that they include (directly or through other roles) and collect all of their permissions
+func LoadEffectiveRolesAndPermissions(databaseConnection *gorm.DB, names []string) (effectiveRoles []string, permissions []string, err error) {
+	visited := map[string]bool{}
+	granted := map[string]bool{}
+	pending := uniqueStrings(names)
+
+	for len(pending) > 0 {
+		var roles []Role
+		err = databaseConnection.Where("name IN (?)", pending).Find(&roles).Error
+		if err != nil {
+			return
+		}
+
+		pending = []string{}
+		for _, role := range roles {
+			if visited[role.Name] {
+				continue
+			}
+
+			visited[role.Name] = true
+			effectiveRoles = append(effectiveRoles, role.Name)
+
+			for _, permission := range role.Permissions {
+				if !granted[permission] {
+					granted[permission] = true
+					permissions = append(permissions, permission)
+				}
+			}
+
+			for _, included := range role.Includes {
+				if !visited[included] {
+					pending = append(pending, included)
+				}
+			}
+		}
+	}
+
+	sort.Strings(effectiveRoles)
+	sort.Strings(permissions)
+
+	return
+}
+
+// Delete will remove the role and unassign it from all accounts
+func (role *Role) Delete(databaseConnection *gorm.DB) (err error) {
+	transaction := databaseConnection.Begin()
+
+	err = transaction.Where("role_id = ?", role.ID).Delete(&AccountRole{}).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Where("role_id = ?", role.ID).Delete(&GroupRole{}).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Where("role_id = ?", role.ID).Delete(&ScopeRole{}).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Where("role_id = ? OR included_role_id = ?", role.ID, role.ID).Delete(&RoleInclusion{}).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Where("role_id = ?", role.ID).Delete(&RolePermission{}).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Delete(role).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Commit().Error
+	return
+}
+
+func loadRoleNamesForAccount(databaseConnection *gorm.DB, accountID string) (names []string, err error) {
+	err = databaseConnection.
+		Table("roles").
+		Joins("JOIN account_roles ON account_roles.role_id = roles.id").
+		Where("account_roles.account_id = ?", accountID).
+		Order("roles.name").
+		Pluck("roles.name", &names).
+		Error
+
+	if names == nil {
+		names = []string{}
+	}
+
+	return
+}
+
+func saveRoleNamesForAccount(databaseConnection *gorm.DB, realm string, accountID string, names []string) (err error) {
+	roles, err := LoadRolesFromNames(InRealm(databaseConnection, realm), names)
+	if err != nil {
+		return
+	}
+
+	err = databaseConnection.Where("account_id = ?", accountID).Delete(&AccountRole{}).Error
+	if err != nil {
+		return
+	}
+
+	for _, role := range roles {
+		err = databaseConnection.Create(&AccountRole{AccountID: accountID, RoleID: role.ID}).Error
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// migrateSerializedRoles moves roles from the legacy comma separated accounts.roles_serialized column into the roles and account_roles tables
+func migrateSerializedRoles(databaseConnection *gorm.DB) (err error) {
+	if !databaseConnection.Dialect().HasColumn("accounts", "roles_serialized") {
+		return
+	}
+
+	rows, err := databaseConnection.Table("accounts").Where("roles_serialized IS NOT NULL AND roles_serialized <> ''").Select("id, roles_serialized").Rows()
+	if err != nil {
+		return
+	}
+
+	serializedRoles := map[string]string{}
+	for rows.Next() {
+		var id, serialized string
+		err = rows.Scan(&id, &serialized)
+		if err != nil {
+			rows.Close()
+			return
+		}
+		serializedRoles[id] = serialized
+	}
+	rows.Close()
+
+	for id, serialized := range serializedRoles {
+		names := strings.Split(serialized, ",")
+
+		err = EnsureRoles(databaseConnection, DefaultRealm, names...)
+		if err != nil {
+			return
+		}
+
+		var existing []string
+		existing, err = loadRoleNamesForAccount(databaseConnection, id)
+		if err != nil {
+			return
+		}
+
+		err = saveRoleNamesForAccount(databaseConnection, DefaultRealm, id, append(existing, names...))
+		if err != nil {
+			return
+		}
+
+		err = databaseConnection.Table("accounts").Where("id = ?", id).UpdateColumn("roles_serialized", "").Error
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func uniqueStrings(values []string) (unique []string) {
+	seen := map[string]bool{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value != "" && !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+
+	return
+}
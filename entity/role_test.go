@@ -0,0 +1,131 @@
+package entity_test
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleLoadRolesFromNames(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	roles, err := entity.LoadRolesFromNames(databaseConnection, []string{"user", "administrator", "user"})
+	assert.NoError(test, err)
+	assert.Equal(test, 2, len(roles))
+
+	_, err = entity.LoadRolesFromNames(databaseConnection, []string{"user", "nonexistent"})
+	assert.Equal(test, entity.ErrUnknownRole, err)
+}
+
+func TestRoleDelete(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	role := entity.Role{Name: "editor"}
+	err = databaseConnection.Create(&role).Error
+	assert.NoError(test, err)
+
+	account := entity.Account{Email: "user@example.com", Roles: []string{"user", "editor"}}
+	err = databaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	err = role.Delete(databaseConnection)
+	assert.NoError(test, err)
+
+	loadedAccount, err := entity.LoadAccountFromID(databaseConnection, account.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, []string{"user"}, loadedAccount.Roles)
+}
+
+func TestRoleMigrateSerializedRoles(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	err = databaseConnection.Exec("ALTER TABLE accounts ADD COLUMN roles_serialized varchar(255)").Error
+	assert.NoError(test, err)
+
+	id := uuid.Must(uuid.NewV4()).String()
+	err = databaseConnection.Exec("INSERT INTO accounts (id, email, roles_serialized) VALUES (?, ?, ?)", id, "user@example.com", "user,administrator,editor").Error
+	assert.NoError(test, err)
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	account, err := entity.LoadAccountFromID(databaseConnection, id)
+	assert.NoError(test, err)
+	assert.Equal(test, []string{"administrator", "editor", "user"}, account.Roles)
+
+	accounts, total, err := entity.LoadAccounts(databaseConnection, entity.AccountQuery{Role: "editor"})
+	assert.NoError(test, err)
+	assert.Equal(test, 1, total)
+	assert.Equal(test, id, accounts[0].ID)
+}
+
+func TestRoleLoadEffectiveRolesAndPermissions(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	reader := entity.Role{Name: "reader", Permissions: []string{"article:read"}}
+	err = databaseConnection.Create(&reader).Error
+	assert.NoError(test, err)
+
+	editor := entity.Role{Name: "editor", Includes: []string{"reader"}, Permissions: []string{"article:write"}}
+	err = databaseConnection.Create(&editor).Error
+	assert.NoError(test, err)
+
+	publisher := entity.Role{Name: "publisher", Includes: []string{"editor", "reader"}, Permissions: []string{"article:publish", "article:read"}}
+	err = databaseConnection.Create(&publisher).Error
+	assert.NoError(test, err)
+
+	loadedRole, err := entity.LoadRoleFromID(databaseConnection, publisher.ID)
+	assert.NoError(test, err)
+	assert.Equal(test, []string{"editor", "reader"}, loadedRole.Includes)
+	assert.Equal(test, []string{"article:publish", "article:read"}, loadedRole.Permissions)
+
+	roles, permissions, err := entity.LoadEffectiveRolesAndPermissions(databaseConnection, []string{"publisher", "user"})
+	assert.NoError(test, err)
+	assert.Equal(test, []string{"editor", "publisher", "reader", "user"}, roles)
+	assert.Equal(test, []string{"article:publish", "article:read", "article:write"}, permissions)
+
+	_, permissions, err = entity.LoadEffectiveRolesAndPermissions(databaseConnection, []string{"administrator"})
+	assert.NoError(test, err)
+	assert.Equal(test, entity.AdministratorPermissions, permissions)
+}
+
+func TestRoleCannotIncludeItself(test *testing.T) {
+	databaseConnection, err := gorm.Open("sqlite3", "/tmp/identity-provider-test-"+uuid.Must(uuid.NewV4()).String()+".db")
+	assert.NoError(test, err)
+	defer databaseConnection.Close()
+
+	err = entity.AutoMigrate(databaseConnection)
+	assert.NoError(test, err)
+
+	role := entity.Role{Name: "editor"}
+	err = databaseConnection.Create(&role).Error
+	assert.NoError(test, err)
+
+	role.Includes = []string{"editor"}
+	err = databaseConnection.Save(&role).Error
+	assert.Equal(test, entity.ErrInvalidRoleInclusion, err)
+}
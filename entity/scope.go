@@ -0,0 +1,135 @@
+package entity
+
+import (
+	"errors"
+
+	"github.com/jinzhu/gorm"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ErrUnknownScope is returned when a client is given a scope that does not exist
+var ErrUnknownScope = errors.New("One or more of the scopes does not exist")
+
+// Scope represents an OAuth scope that clients can request, a token issued for the scope only carries the roles of the scope that the account has
+type Scope struct {
+	ID          string   `json:"id" gorm:"primary_key;size:36" validate:"uuid4,required"`
+	RealmID     string   `json:"-" gorm:"size:50;unique_index:idx_scopes_realm_name"`
+	Name        string   `json:"name" gorm:"not null;size:100;unique_index:idx_scopes_realm_name" validate:"required,max=100,excludesall=0x20"`
+	Description string   `json:"description" gorm:"size:255" validate:"max=255"`
+	Roles       []string `json:"roles" gorm:"-"`
+}
+
+// ScopeRole joins scopes with the roles that they grant
+type ScopeRole struct {
+	ScopeID string `gorm:"primary_key;size:36"`
+	RoleID  string `gorm:"primary_key;size:36;index"`
+}
+
+// BeforeSave will run before the struct is persisted with gorm
+func (scope *Scope) BeforeSave() {
+	if scope.ID == "" {
+		scope.ID = uuid.Must(uuid.NewV4()).String()
+	}
+
+	if scope.RealmID == "" {
+		scope.RealmID = DefaultRealm
+	}
+}
+
+// AfterSave will run after the struct has been persisted with gorm and replaces the roles of the scope
+func (scope *Scope) AfterSave(databaseConnection *gorm.DB) (err error) {
+	roles, err := LoadRolesFromNames(InRealm(databaseConnection, scope.RealmID), scope.Roles)
+	if err != nil {
+		return
+	}
+
+	err = databaseConnection.Where("scope_id = ?", scope.ID).Delete(&ScopeRole{}).Error
+	if err != nil {
+		return
+	}
+
+	for _, role := range roles {
+		err = databaseConnection.Create(&ScopeRole{ScopeID: scope.ID, RoleID: role.ID}).Error
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// AfterFind will run after the struct has been read from persistence
+func (scope *Scope) AfterFind(databaseConnection *gorm.DB) (err error) {
+	err = databaseConnection.
+		Table("roles").
+		Joins("JOIN scope_roles ON scope_roles.role_id = roles.id").
+		Where("scope_roles.scope_id = ?", scope.ID).
+		Order("roles.name").
+		Pluck("roles.name", &scope.Roles).
+		Error
+
+	if scope.Roles == nil {
+		scope.Roles = []string{}
+	}
+
+	return
+}
+
+// Delete will remove the scope from all clients and consents
+func (scope *Scope) Delete(databaseConnection *gorm.DB) (err error) {
+	transaction := databaseConnection.Begin()
+
+	err = transaction.Where("scope_id = ?", scope.ID).Delete(&ScopeRole{}).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Where("scope_id = ?", scope.ID).Delete(&ClientScope{}).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Where("scope_id = ?", scope.ID).Delete(&Consent{}).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Delete(scope).Error
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Commit().Error
+	return
+}
+
+// LoadScopes will fetch all scopes ordered by name
+func LoadScopes(databaseConnection *gorm.DB) (scopes []Scope, err error) {
+	err = databaseConnection.Order("name").Find(&scopes).Error
+	return
+}
+
+// LoadScopeFromID will fetch the scope from the persistence
+func LoadScopeFromID(databaseConnection *gorm.DB, id string) (scope Scope, err error) {
+	err = databaseConnection.Where("id = ?", id).First(&scope).Error
+	return
+}
+
+// LoadScopesFromNames will fetch the scopes with the given names, ErrUnknownScope is returned if any of them does not exist
+func LoadScopesFromNames(databaseConnection *gorm.DB, names []string) (scopes []Scope, err error) {
+	unique := uniqueStrings(names)
+	if len(unique) == 0 {
+		return
+	}
+
+	err = databaseConnection.Where("name IN (?)", unique).Order("name").Find(&scopes).Error
+	if err == nil && len(scopes) != len(unique) {
+		err = ErrUnknownScope
+	}
+
+	return
+}
@@ -1,25 +1,113 @@
 package main // import "github.com/mojlighetsministeriet/identity-provider"
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
 	_ "github.com/jinzhu/gorm/dialects/mssql"
 	_ "github.com/jinzhu/gorm/dialects/mysql"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
 	"github.com/mojlighetsministeriet/identity-provider/service"
 	"github.com/mojlighetsministeriet/utils"
 	"github.com/mojlighetsministeriet/utils/emailtemplates"
+	"github.com/mojlighetsministeriet/utils/httprequest"
 )
 
 func main() {
 	identityService := service.Service{}
+	identityService.AccountRestorePeriod = time.Duration(getEnvAsInt("ACCOUNT_RESTORE_DAYS", 30)*24) * time.Hour
+	identityService.ExpiryWarningPeriod = time.Duration(getEnvAsInt("ACCOUNT_EXPIRY_WARNING_DAYS", 7)*24) * time.Hour
+	identityService.TokenAttributes = getEnvAsList("TOKEN_ATTRIBUTES")
+	identityService.Registration = service.RegistrationSettings{
+		Enabled:         utils.GetEnv("REGISTRATION_ENABLED", "false") == "true",
+		RequireApproval: utils.GetEnv("REGISTRATION_REQUIRE_APPROVAL", "false") == "true",
+		AllowedDomains:  getEnvAsList("REGISTRATION_ALLOWED_DOMAINS"),
+		DeniedDomains:   getEnvAsList("REGISTRATION_DENIED_DOMAINS"),
+		DefaultRoles:    getEnvAsList("REGISTRATION_DEFAULT_ROLES"),
+	}
+	if len(identityService.Registration.DefaultRoles) == 0 {
+		identityService.Registration.DefaultRoles = []string{"user"}
+	}
+	identityService.PasswordPolicy = entity.PasswordPolicy{
+		MinimumLength:    getEnvAsInt("PASSWORD_MINIMUM_LENGTH", 10),
+		MaximumLength:    getEnvAsInt("PASSWORD_MAXIMUM_LENGTH", entity.MaximumPasswordBytes),
+		RequireLowercase: utils.GetEnv("PASSWORD_REQUIRE_LOWERCASE", "false") == "true",
+		RequireUppercase: utils.GetEnv("PASSWORD_REQUIRE_UPPERCASE", "false") == "true",
+		RequireDigit:     utils.GetEnv("PASSWORD_REQUIRE_DIGIT", "false") == "true",
+		RequireSymbol:    utils.GetEnv("PASSWORD_REQUIRE_SYMBOL", "false") == "true",
+		RejectEmail:      utils.GetEnv("PASSWORD_REJECT_EMAIL", "true") == "true",
+		History:          getEnvAsInt("PASSWORD_HISTORY", 5),
+		MaximumAge:       time.Duration(getEnvAsInt("PASSWORD_MAXIMUM_AGE_DAYS", 0)*24) * time.Hour,
+	}
+
+	if utils.GetEnv("BREACHED_PASSWORDS_FILE", "") != "" {
+		breachedPasswords, err := entity.LoadBreachedPasswordList(utils.GetEnv("BREACHED_PASSWORDS_FILE", ""))
+		if err != nil {
+			panic(err)
+		}
+		identityService.PasswordPolicy.BreachedPasswords = breachedPasswords
+	}
+
+	switch utils.GetEnv("PASSWORD_HASHER", "argon2id") {
+	case "argon2id":
+		hasher := entity.DefaultArgon2idHasher()
+		hasher.Memory = uint32(getEnvAsInt("PASSWORD_ARGON2_MEMORY", int(hasher.Memory)))
+		hasher.Iterations = uint32(getEnvAsInt("PASSWORD_ARGON2_ITERATIONS", int(hasher.Iterations)))
+		hasher.Parallelism = uint8(getEnvAsInt("PASSWORD_ARGON2_PARALLELISM", int(hasher.Parallelism)))
+		entity.PasswordHashing = hasher
+	case "bcrypt":
+		entity.PasswordHashing = &entity.BcryptHasher{Cost: getEnvAsInt("PASSWORD_BCRYPT_COST", 10)}
+	default:
+		panic("PASSWORD_HASHER must be argon2id or bcrypt")
+	}
+
+	identityService.EmailSender = getEmailSender()
+
+	if utils.GetEnv("EMAIL_TEMPLATES_DIRECTORY", "") != "" {
+		localizedEmailTemplates, err := service.LoadLocalizedEmailTemplates(
+			utils.GetEnv("EMAIL_TEMPLATES_DIRECTORY", ""),
+			utils.GetEnv("EMAIL_DEFAULT_LOCALE", "en"),
+		)
+		if err != nil {
+			panic(err)
+		}
+		identityService.LocalizedEmailTemplates = localizedEmailTemplates
+	}
+	identityService.EmailMaxAttempts = getEnvAsInt("EMAIL_MAX_ATTEMPTS", 8)
+	identityService.EmailRetryDelay = time.Duration(getEnvAsInt("EMAIL_RETRY_DELAY_SECONDS", 30)) * time.Second
 
 	newAccountTemplate := emailtemplates.Template{
+		Name:    "new-account",
 		Subject: utils.GetEnv("EMAIL_ACCOUNT_CREATED_SUBJECT", "Your new account"),
 		Body:    utils.GetEnv("EMAIL_ACCOUNT_CREATED_BODY", "You have a new account, choose your password <a href=\"{{.ServiceURL}}/reset-password?token={{.ResetToken}}\" target=\"_blank\">here</a>."),
 	}
 	resetPasswordTemplate := emailtemplates.Template{
+		Name:    "reset-password",
 		Subject: utils.GetEnv("EMAIL_ACCOUNT_RESET_SUBJECT", "Password reset"),
 		Body:    utils.GetEnv("EMAIL_ACCOUNT_RESET_BODY", "You have requested a password reset, choose your new password <a href=\"{{.ServiceURL}}/reset-password?token={{.ResetToken}}\" target=\"_blank\">here</a>. If you did not request a password reset, please ignore this message."),
 	}
+	accountExpiringTemplate := emailtemplates.Template{
+		Name:    "account-expiring",
+		Subject: utils.GetEnv("EMAIL_ACCOUNT_EXPIRING_SUBJECT", "Your account is about to expire"),
+		Body:    utils.GetEnv("EMAIL_ACCOUNT_EXPIRING_BODY", "Your account {{.Email}} will expire {{.ExpiresAt.Format \"2006-01-02 15:04\"}}. Contact your administrator if you need access for a longer period."),
+	}
+	loginLinkTemplate := emailtemplates.Template{
+		Name:    "login-link",
+		Subject: utils.GetEnv("EMAIL_LOGIN_LINK_SUBJECT", "Your login link"),
+		Body:    utils.GetEnv("EMAIL_LOGIN_LINK_BODY", "Log in <a href=\"{{.ServiceURL}}/login?token={{.LoginToken}}\" target=\"_blank\">here</a>. The link can only be used once and expires in 15 minutes. If you did not request it, please ignore this message."),
+	}
+	verifyEmailTemplate := emailtemplates.Template{
+		Name:    "verify-email",
+		Subject: utils.GetEnv("EMAIL_VERIFY_EMAIL_SUBJECT", "Verify your email"),
+		Body:    utils.GetEnv("EMAIL_VERIFY_EMAIL_BODY", "Thank you for signing up, verify your email <a href=\"{{.ServiceURL}}/verify-email?token={{.VerificationToken}}\" target=\"_blank\">here</a>. If you did not sign up, please ignore this message."),
+	}
+
+	templatesErr := identityService.SetEmailTemplates(accountExpiringTemplate, loginLinkTemplate, verifyEmailTemplate)
+	if templatesErr != nil {
+		panic(templatesErr)
+	}
 
 	initializeErr := identityService.Initialize(
 		utils.GetEnv("DATABASE_TYPE", "mysql"),
@@ -50,3 +138,54 @@ func main() {
 		panic(listenErr)
 	}
 }
+
+// getEmailSender returns the email backend that is selected by EMAIL_BACKEND
+func getEmailSender() service.EmailSender {
+	switch utils.GetEnv("EMAIL_BACKEND", "http") {
+	case "http":
+		client, err := httprequest.NewJSONClient()
+		if err != nil {
+			panic(err)
+		}
+		return &service.HTTPEmailSender{URL: utils.GetEnv("EMAIL_HTTP_URL", "http://email"), Client: client}
+	case "smtp":
+		tlsConfig, err := utils.GetCACertificatesTLSConfig()
+		if err != nil {
+			panic(err)
+		}
+		return &service.SMTPEmailSender{
+			Host:          utils.GetEnv("SMTP_HOST", "localhost"),
+			Port:          getEnvAsInt("SMTP_PORT", 587),
+			From:          utils.GetEnv("SMTP_EMAIL", ""),
+			Username:      utils.GetEnv("SMTP_USERNAME", utils.GetEnv("SMTP_EMAIL", "")),
+			Password:      strings.TrimSpace(utils.GetFileAsString("/run/secrets/smtp-password", utils.GetEnv("SMTP_PASSWORD", ""))),
+			TLSConfig:     tlsConfig,
+			AllowInsecure: utils.GetEnv("SMTP_ALLOW_INSECURE", "false") == "true",
+		}
+	case "file":
+		return &service.FileEmailSender{Path: utils.GetEnv("EMAIL_FILE", "")}
+	default:
+		panic("EMAIL_BACKEND must be http, smtp or file")
+	}
+}
+
+func getEnvAsInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(utils.GetEnv(key, strconv.Itoa(defaultValue)))
+	if err != nil {
+		return defaultValue
+	}
+
+	return value
+}
+
+func getEnvAsList(key string) []string {
+	list := []string{}
+	for _, value := range strings.Split(utils.GetEnv(key, ""), ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			list = append(list, value)
+		}
+	}
+
+	return list
+}
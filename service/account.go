@@ -1,14 +1,16 @@
 package service
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/jinzhu/copier"
+	"github.com/jinzhu/gorm"
 	"github.com/labstack/echo"
 	"github.com/mojlighetsministeriet/identity-provider/entity"
-	"github.com/mojlighetsministeriet/utils"
 	"github.com/mojlighetsministeriet/utils/jwt"
 	uuid "github.com/satori/go.uuid"
 	validator "gopkg.in/go-playground/validator.v9"
@@ -16,38 +18,53 @@ import (
 
 func (service *Service) accountResource() {
 	accountGroup := service.Router.Group("/account")
-	accountGroup.Use(jwt.RequiredRoleMiddleware(&service.PrivateKey.PublicKey, "administrator"))
+	canRead := service.requirePermission("account:read")
+	canWrite := service.requirePermission("account:write")
 
 	// TODO: Add better validation error messages
 	accountGroup.POST("", func(context echo.Context) error {
-		entityWithPassword := entity.AccountWithPassword{}
-		err := context.Bind(&entityWithPassword)
+		// Only these properties can be given, the others such as deletedAt and emailVerified are kept by the service
+		type newAccountBody struct {
+			ID                 string     `json:"id"`
+			Email              string     `json:"email"`
+			Password           string     `json:"password"`
+			Roles              []string   `json:"roles"`
+			Locale             string     `json:"locale"`
+			ExpiresAt          *time.Time `json:"expiresAt"`
+			MustChangePassword bool       `json:"mustChangePassword"`
+		}
+
+		parameters := newAccountBody{}
+		err := context.Bind(&parameters)
 		if err != nil {
 			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
 		}
 
-		account := entity.Account{}
-		copier.Copy(&account, &entityWithPassword)
+		account := entity.Account{
+			ID:                 parameters.ID,
+			RealmID:            realmFromContext(context).Realm.Name,
+			Email:              parameters.Email,
+			Password:           parameters.Password,
+			Roles:              parameters.Roles,
+			Locale:             parameters.Locale,
+			ExpiresAt:          parameters.ExpiresAt,
+			MustChangePassword: parameters.MustChangePassword,
+		}
 
-		expiration := time.Now().Add(time.Duration(3600*24*7) * time.Second)
-		resetToken, err := jwt.GenerateWithCustomExpiration(
-			"identity-provider",
-			service.PrivateKey,
-			&account,
-			expiration,
-		)
-		if err != nil {
-			service.Log.Error(err)
-			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Internal Server Error\"}"))
+		if account.IsExpired() {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The expiration time has already passed\"}"))
 		}
 
-		if account.Password == "" {
-			err = account.SetPasswordResetToken(string(resetToken))
-			if err != nil {
-				service.Log.Error(err)
-				return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Internal Server Error\"}"))
+		if !entity.IsValidLocale(account.Locale) {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The locale must be a language tag such as sv or en-GB\"}"))
+		}
+
+		invite := account.Password == ""
+		if !invite {
+			if rejected, err := service.rejectPassword(context, account.Password, account.Email); rejected {
+				return err
 			}
-		} else {
+
 			err = account.SetPassword(account.Password)
 			if err != nil {
 				return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
@@ -64,7 +81,27 @@ func (service *Service) accountResource() {
 			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
 		}
 
-		err = service.DatabaseConnection.Create(&account).Error
+		_, err = entity.LoadRolesFromNames(service.realmDatabase(context), account.Roles)
+		if err == entity.ErrUnknownRole {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"One or more of the roles does not exist\"}"))
+		} else if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		// The account is only created if its invitation could be queued as well
+		err = service.inTransaction(func(transaction *gorm.DB) error {
+			createErr := transaction.Create(&account).Error
+			if createErr != nil || !invite {
+				return createErr
+			}
+
+			claims, _ := jwt.GetClaimsFromContextIfValid(&realmFromContext(context).PrivateKey.PublicKey, context)
+			invitedBy, _ := claims.Get("sub").(string)
+
+			invitation := entity.Invitation{RealmID: account.RealmID, AccountID: account.ID, Email: account.Email, InvitedBy: invitedBy}
+			return service.sendInvitation(context, transaction, &invitation, account.Locale)
+		})
 		if err != nil {
 			// TODO: handle for non-MySQL databases as well
 			if strings.HasPrefix(err.Error(), "Error 1062") {
@@ -75,42 +112,256 @@ func (service *Service) accountResource() {
 			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
 		}
 
-		if account.Password == "" && account.PasswordResetToken != "" {
-			email, err := service.EmailTemplates.Render(
-				"new-account",
-				account.Email,
-				nil,
-				struct {
-					ServiceURL string
-					ResetToken string
-				}{utils.GetOriginalSystemURLFromContext(context), string(resetToken)},
-			)
+		return context.JSONBlob(http.StatusCreated, []byte("{\"message\":\"Created\"}"))
+	}, canWrite)
+
+	accountGroup.GET("", func(context echo.Context) error {
+		page, err := getPaginationFromContext(context)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\""+err.Error()+"\"}"))
+		}
+
+		query, err := getAccountQueryFromContext(context)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\""+err.Error()+"\"}"))
+		}
+		query.Offset = page.Offset()
+		query.Limit = page.PerPage
+
+		entities, total, err := entity.LoadAccounts(service.realmDatabase(context), query)
+		if err == nil {
+			if entities == nil {
+				entities = []entity.Account{}
+			}
+
+			setPaginationHeaders(context, page, total)
+			return context.JSON(http.StatusOK, entities)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canRead)
+
+	accountGroup.PUT("/:id", func(context echo.Context) error {
+		// The properties are pointers so that properties that are left out keep their current value, expiresAt is kept raw to tell a left out expiresAt from null which removes the expiration time
+		type accountChanges struct {
+			Email              *string         `json:"email"`
+			Password           string          `json:"password"`
+			Roles              *[]string       `json:"roles"`
+			Locale             *string         `json:"locale"`
+			MustChangePassword *bool           `json:"mustChangePassword"`
+			ExpiresAt          json.RawMessage `json:"expiresAt"`
+		}
+
+		changes := accountChanges{}
+		err := context.Bind(&changes)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		account, err := entity.LoadAccountFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		if changes.Email != nil {
+			if account.Email != *changes.Email {
+				account.EmailVerified = false
+			}
+			account.Email = *changes.Email
+		}
+
+		if changes.Roles != nil {
+			account.Roles = *changes.Roles
+		}
+
+		if changes.MustChangePassword != nil {
+			account.MustChangePassword = *changes.MustChangePassword
+		}
+
+		if changes.Locale != nil {
+			if !entity.IsValidLocale(*changes.Locale) {
+				return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The locale must be a language tag such as sv or en-GB\"}"))
+			}
+			account.Locale = *changes.Locale
+		}
+
+		if len(changes.ExpiresAt) > 0 {
+			var expiresAt *time.Time
+			err = json.Unmarshal(changes.ExpiresAt, &expiresAt)
 			if err != nil {
-				service.Log.Error(err)
-				return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+				return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+			}
+
+			if !sameTime(account.ExpiresAt, expiresAt) {
+				account.SetExpiresAt(expiresAt)
+				if account.IsExpired() {
+					return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The expiration time has already passed\"}"))
+				}
+			}
+		}
+
+		previousHash := ""
+		if changes.Password != "" {
+			if rejected, err := service.rejectPassword(context, changes.Password, account.Email); rejected {
+				return err
 			}
 
-			err = service.HTTPClient.Post("http://email", email, nil)
+			previousHash = account.Password
+			err = account.SetPassword(changes.Password)
 			if err != nil {
-				service.Log.Error(err)
-				return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+				return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
 			}
 		}
 
-		return context.JSONBlob(http.StatusCreated, []byte("{\"message\":\"Created\"}"))
-	})
+		validate := validator.New()
+		err = validate.Struct(account)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
 
-	accountGroup.GET("", func(context echo.Context) error {
-		var entities []entity.Account
+		_, err = entity.LoadRolesFromNames(service.realmDatabase(context), account.Roles)
+		if err == entity.ErrUnknownRole {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"One or more of the roles does not exist\"}"))
+		} else if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		// The previous password is remembered together with the change so that it cannot drop out of the history
+		err = service.inTransaction(func(transaction *gorm.DB) error {
+			err := transaction.Save(&account).Error
+			if err != nil {
+				return err
+			}
+
+			return entity.RememberPreviousPassword(transaction, account.ID, previousHash, service.PasswordPolicy.History)
+		})
+		if err != nil {
+			// TODO: handle for non-MySQL databases as well
+			if strings.HasPrefix(err.Error(), "Error 1062") {
+				return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The email was already taken\"}"))
+			}
 
-		err := service.DatabaseConnection.Find(&entities).Error
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSON(http.StatusOK, account)
+	}, canWrite)
+
+	accountGroup.GET("/expiring", func(context echo.Context) error {
+		days := 7
+		if context.QueryParam("days") != "" {
+			var err error
+			days, err = strconv.Atoi(context.QueryParam("days"))
+			if err != nil || days < 0 {
+				return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+			}
+		}
+
+		entities, err := entity.LoadAccountsExpiringBefore(service.realmDatabase(context), time.Now().Add(time.Duration(days*24)*time.Hour))
 		if err == nil {
 			return context.JSON(http.StatusOK, entities)
 		}
 
 		service.Log.Error(err)
 		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
-	})
+	}, canRead)
+
+	accountGroup.GET("/deleted", func(context echo.Context) error {
+		entities, err := entity.LoadDeletedAccounts(service.realmDatabase(context))
+		if err == nil {
+			return context.JSON(http.StatusOK, entities)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canRead)
+
+	accountGroup.DELETE("/:id", func(context echo.Context) error {
+		claims, err := jwt.GetClaimsFromContextIfValid(&realmFromContext(context).PrivateKey.PublicKey, context)
+		if err != nil {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		if claims.Get("sub") == context.Param("id") {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"You cannot delete your own account\"}"))
+		}
+
+		account, err := entity.LoadAccountFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		err = service.DatabaseConnection.Delete(&account).Error
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Deleted\"}"))
+	}, canWrite)
+
+	accountGroup.POST("/:id/restore", func(context echo.Context) error {
+		account, err := entity.LoadDeletedAccountFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		if account.DeletedAt.Before(time.Now().Add(-service.AccountRestorePeriod)) {
+			return context.JSONBlob(http.StatusGone, []byte("{\"message\":\"The restore period for the account has expired\"}"))
+		}
+
+		err = account.Restore(service.DatabaseConnection)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSON(http.StatusOK, account)
+	}, canWrite)
+
+	accountGroup.GET("/:id/attributes", func(context echo.Context) error {
+		account, err := entity.LoadAccountFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		attributes, err := entity.LoadAccountAttributes(service.DatabaseConnection, account.ID)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSON(http.StatusOK, attributes)
+	}, canRead)
+
+	accountGroup.PUT("/:id/attributes", func(context echo.Context) error {
+		account, err := entity.LoadAccountFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		attributes := map[string]string{}
+		err = context.Bind(&attributes)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		err = entity.ValidateAccountAttributes(attributes)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\""+err.Error()+"\"}"))
+		}
+
+		err = entity.SaveAccountAttributes(service.DatabaseConnection, account.ID, attributes)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSON(http.StatusOK, attributes)
+	}, canWrite)
 
 	service.Router.POST("/account/reset-token/password", func(context echo.Context) error {
 		type resetPasswordBody struct {
@@ -125,22 +376,39 @@ func (service *Service) accountResource() {
 			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
 		}
 
-		claims, err := jwt.GetClaimsFromContextIfValid(&service.PrivateKey.PublicKey, context)
+		claims, err := jwt.GetClaimsFromContextIfValid(&realmFromContext(context).PrivateKey.PublicKey, context)
 		if err != nil {
 			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
 		}
 
 		resetToken := jwt.GetTokenFromContext(context)
-		account, err := entity.LoadAccountFromEmail(service.DatabaseConnection, claims.Get("email").(string))
+		account, err := entity.LoadAccountFromEmail(service.realmDatabase(context), claims.Get("email").(string))
 		if err != nil || account.CompareHashedPasswordResetTokenAgainst(string(resetToken)) != nil {
 			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
 		}
 
+		// Only the latest sent invitation link can be used to accept an invitation
+		invitation, invitationErr := entity.LoadOpenInvitationForAccount(service.DatabaseConnection, account.ID)
+		hasInvitation := invitationErr == nil
+		if hasInvitation && !invitation.MatchesToken(string(resetToken)) {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		if rejected, err := service.rejectPassword(context, parameters.Password, account.Email); rejected {
+			return err
+		}
+
+		if rejected, err := service.rejectReusedPassword(context, &account, parameters.Password); rejected {
+			return err
+		}
+
+		previousHash := account.Password
 		err = account.SetPassword(parameters.Password)
 		if err != nil {
 			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
 		}
 		account.PasswordResetToken = ""
+		account.MustChangePassword = false
 
 		validate := validator.New()
 		err = validate.Struct(account)
@@ -149,7 +417,23 @@ func (service *Service) accountResource() {
 			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
 		}
 
-		err = service.DatabaseConnection.Save(&account).Error
+		err = service.inTransaction(func(transaction *gorm.DB) error {
+			err := transaction.Save(&account).Error
+			if err != nil {
+				return err
+			}
+
+			err = entity.RememberPreviousPassword(transaction, account.ID, previousHash, service.PasswordPolicy.History)
+			if err != nil {
+				return err
+			}
+
+			if hasInvitation {
+				return invitation.Accept(transaction)
+			}
+
+			return nil
+		})
 		if err != nil {
 			service.Log.Error(err)
 			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
@@ -166,7 +450,7 @@ func (service *Service) accountResource() {
 		parameters := emailBody{}
 		context.Bind(&parameters)
 
-		account, err := entity.LoadAccountFromEmail(service.DatabaseConnection, parameters.Email)
+		account, err := entity.LoadAccountFromEmail(service.realmDatabase(context), parameters.Email)
 		if err != nil {
 			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
 		}
@@ -175,10 +459,24 @@ func (service *Service) accountResource() {
 			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
 		}
 
+		// An invitee that asks for a reset gets the invitation again since only its latest link accepts it
+		invitation, err := entity.LoadOpenInvitationForAccount(service.DatabaseConnection, account.ID)
+		if err == nil {
+			err = service.inTransaction(func(transaction *gorm.DB) error {
+				return service.sendInvitation(context, transaction, &invitation, account.Locale)
+			})
+			if err != nil {
+				service.Log.Error(err)
+				return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+			}
+
+			return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Reset token created\"}"))
+		}
+
 		expiration := time.Now().Add(time.Duration(3600) * time.Second)
 		resetToken, err := jwt.GenerateWithCustomExpiration(
-			"identity-provider",
-			service.PrivateKey,
+			realmFromContext(context).Realm.Issuer(),
+			realmFromContext(context).PrivateKey,
 			&entity.Account{Email: parameters.Email},
 			expiration,
 		)
@@ -197,32 +495,80 @@ func (service *Service) accountResource() {
 			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
 		}
 
-		err = service.DatabaseConnection.Save(&account).Error
+		err = service.inTransaction(func(transaction *gorm.DB) error {
+			saveErr := transaction.Save(&account).Error
+			if saveErr != nil {
+				return saveErr
+			}
+
+			return service.queueEmail(
+				transaction,
+				realmFromContext(context),
+				"reset-password",
+				account.Email,
+				account.Locale,
+				struct {
+					ServiceURL string
+					ResetToken string
+				}{serviceURLFromContext(context), string(resetToken)},
+			)
+		})
 		if err != nil {
 			service.Log.Error(err)
 			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
 		}
 
-		email, err := service.EmailTemplates.Render(
-			"reset-password",
-			account.Email,
-			nil,
-			struct {
-				ServiceURL string
-				ResetToken string
-			}{utils.GetOriginalSystemURLFromContext(context), string(resetToken)},
-		)
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Reset token created\"}"))
+	})
+}
+
+func sameTime(first *time.Time, second *time.Time) bool {
+	if first == nil || second == nil {
+		return first == second
+	}
+
+	return first.Equal(*second)
+}
+
+func getAccountQueryFromContext(context echo.Context) (query entity.AccountQuery, err error) {
+	query.Email = context.QueryParam("email")
+	query.Role = context.QueryParam("role")
+
+	query.Sort = context.QueryParam("sort")
+	if !entity.IsValidAccountSort(query.Sort) {
+		err = errors.New("sort must be one of email, createdAt or expiresAt optionally prefixed with -")
+		return
+	}
+
+	if context.QueryParam("enabled") != "" {
+		var enabled bool
+		enabled, err = strconv.ParseBool(context.QueryParam("enabled"))
 		if err != nil {
-			service.Log.Error(err)
-			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+			err = errors.New("enabled must be true or false")
+			return
 		}
+		query.Enabled = &enabled
+	}
 
-		err = service.HTTPClient.Post("http://email", email, nil)
+	if context.QueryParam("createdAfter") != "" {
+		var createdAfter time.Time
+		createdAfter, err = time.Parse(time.RFC3339, context.QueryParam("createdAfter"))
 		if err != nil {
-			service.Log.Error(err)
-			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+			err = errors.New("createdAfter must be a RFC 3339 timestamp")
+			return
 		}
+		query.CreatedAfter = &createdAfter
+	}
 
-		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Reset token created\"}"))
-	})
+	if context.QueryParam("createdBefore") != "" {
+		var createdBefore time.Time
+		createdBefore, err = time.Parse(time.RFC3339, context.QueryParam("createdBefore"))
+		if err != nil {
+			err = errors.New("createdBefore must be a RFC 3339 timestamp")
+			return
+		}
+		query.CreatedBefore = &createdBefore
+	}
+
+	return
 }
@@ -0,0 +1,47 @@
+package service_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAccountOnlyTakesTheAllowedProperties(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	administrator := createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	administratorToken := loginTestAccount(test, identityService, administrator.Email)
+
+	expiresAt := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	past := time.Now().Add(-365 * 24 * time.Hour)
+	response := serveTestRequest(identityService, http.MethodPost, "/account", administratorToken, map[string]interface{}{
+		"email":              "user@example.com",
+		"password":           testPassword,
+		"roles":              []string{"user"},
+		"locale":             "sv",
+		"expiresAt":          expiresAt,
+		"mustChangePassword": true,
+		"deletedAt":          past,
+		"createdAt":          past,
+		"passwordChangedAt":  past,
+		"status":             entity.AccountAwaitingApproval,
+		"emailVerified":      true,
+	})
+	assert.Equal(test, http.StatusCreated, response.Code)
+
+	account, err := entity.LoadAccountFromEmail(identityService.DatabaseConnection, "user@example.com")
+	assert.NoError(test, err)
+	assert.Equal(test, []string{"user"}, account.Roles)
+	assert.Equal(test, "sv", account.Locale)
+	assert.True(test, account.MustChangePassword)
+	assert.True(test, expiresAt.Equal(*account.ExpiresAt))
+	assert.Nil(test, account.DeletedAt)
+	assert.True(test, account.CreatedAt.After(past.Add(time.Hour)))
+	assert.Empty(test, account.Status)
+	assert.False(test, account.EmailVerified)
+	assert.NoError(test, account.CompareHashedPasswordAgainst(testPassword))
+}
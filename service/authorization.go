@@ -0,0 +1,51 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/utils/jwt"
+)
+
+// requirePermission returns a middleware that only lets requests through if they carry a valid token, that is not a revoked impersonation or meant for another audience, with the permission in its permissions claim
+func (service *Service) requirePermission(permission string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(context echo.Context) error {
+			claims, err := jwt.GetClaimsFromContextIfValid(&realmFromContext(context).PrivateKey.PublicKey, context)
+			if err != nil || service.isRevokedImpersonation(claims) {
+				return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+			}
+
+			// A token that was exchanged for another audience is only meant to be used with that service
+			audience := claims.Get("aud")
+			if audience != nil && audience != realmFromContext(context).Realm.Issuer() && !claimContains(audience, realmFromContext(context).Realm.Issuer()) {
+				return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+			}
+
+			if !claimContains(claims.Get("permissions"), permission) {
+				return context.JSONBlob(http.StatusForbidden, []byte("{\"message\":\"Forbidden\"}"))
+			}
+
+			return next(context)
+		}
+	}
+}
+
+func claimContains(claim interface{}, value string) bool {
+	switch values := claim.(type) {
+	case []interface{}:
+		for _, item := range values {
+			if item == value {
+				return true
+			}
+		}
+	case []string:
+		for _, item := range values {
+			if item == value {
+				return true
+			}
+		}
+	}
+
+	return false
+}
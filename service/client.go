@@ -0,0 +1,169 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+func (service *Service) clientResource() {
+	clientGroup := service.Router.Group("/client")
+	canRead := service.requirePermission("client:read")
+	canWrite := service.requirePermission("client:write")
+
+	clientGroup.GET("", func(context echo.Context) error {
+		clients, err := entity.LoadClients(service.realmDatabase(context))
+		if err == nil {
+			return context.JSON(http.StatusOK, clients)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canRead)
+
+	clientGroup.POST("", func(context echo.Context) error {
+		client := entity.Client{}
+		err := context.Bind(&client)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		client.ID = ""
+		client.RealmID = realmFromContext(context).Realm.Name
+		client.BeforeSave()
+
+		return service.saveClient(context, client, true)
+	}, canWrite)
+
+	clientGroup.GET("/:id", func(context echo.Context) error {
+		client, err := entity.LoadClientFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		return context.JSON(http.StatusOK, client)
+	}, canRead)
+
+	clientGroup.PUT("/:id", func(context echo.Context) error {
+		client, err := entity.LoadClientFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		changes := entity.Client{}
+		err = context.Bind(&changes)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		client.Name = changes.Name
+		client.Description = changes.Description
+		client.FirstParty = changes.FirstParty
+		client.Scopes = changes.Scopes
+
+		return service.saveClient(context, client, false)
+	}, canWrite)
+
+	clientGroup.POST("/:id/secret", func(context echo.Context) error {
+		client, err := entity.LoadClientFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		secret, err := client.GenerateSecret()
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		err = service.DatabaseConnection.Model(&client).UpdateColumn("secret_hash", client.SecretHash).Error
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSON(http.StatusOK, struct {
+			Secret string `json:"secret"`
+		}{Secret: secret})
+	}, canWrite)
+
+	clientGroup.DELETE("/:id", func(context echo.Context) error {
+		client, err := entity.LoadClientFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		err = client.Delete(service.DatabaseConnection)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Deleted\"}"))
+	}, canWrite)
+}
+
+func (service *Service) saveClient(context echo.Context, client entity.Client, isNew bool) error {
+	validate := validator.New()
+	err := validate.Struct(client)
+	if err != nil {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+	}
+
+	_, err = entity.LoadScopesFromNames(service.realmDatabase(context), client.Scopes)
+	if err == entity.ErrUnknownScope {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"One or more of the scopes does not exist\"}"))
+	} else if err != nil {
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	// The secret is only shown when it is generated, a client that lost it gets a new one from /client/<id>/secret
+	var secret string
+	if isNew {
+		secret, err = client.GenerateSecret()
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		err = service.DatabaseConnection.Create(&client).Error
+	} else {
+		err = service.DatabaseConnection.Save(&client).Error
+	}
+	if err != nil {
+		// TODO: handle for non-MySQL databases as well
+		if strings.HasPrefix(err.Error(), "Error 1062") {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The name was already taken\"}"))
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	if isNew {
+		return context.JSON(http.StatusCreated, struct {
+			entity.Client
+			Secret string `json:"secret"`
+		}{Client: client, Secret: secret})
+	}
+
+	return context.JSON(http.StatusOK, client)
+}
+
+// authenticateClient returns true if the client exists and the caller may request tokens for it, first party clients skip consent so they always have to give their secret while third party clients only have to if they give one
+func (service *Service) authenticateClient(context echo.Context, clientID string, secret string) bool {
+	client, err := entity.LoadClientFromID(service.realmDatabase(context), clientID)
+	if err != nil {
+		return false
+	}
+
+	if client.FirstParty || secret != "" {
+		return client.MatchesSecret(secret)
+	}
+
+	return true
+}
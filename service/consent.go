@@ -0,0 +1,191 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/mojlighetsministeriet/utils/jwt"
+)
+
+func (service *Service) consentResource() {
+	consentGroup := service.Router.Group("/consent")
+
+	consentGroup.GET("", func(context echo.Context) error {
+		accountID, authorized := service.accountIDForConsent(context)
+		if !authorized {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		consents, err := entity.LoadConsentsForAccount(service.DatabaseConnection, accountID)
+		if err == nil {
+			return context.JSON(http.StatusOK, consents)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	})
+
+	consentGroup.POST("", func(context echo.Context) error {
+		type consentBody struct {
+			ClientID string   `json:"clientId"`
+			Scopes   []string `json:"scopes"`
+		}
+
+		accountID, authorized := service.accountIDForConsent(context)
+		if !authorized {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		parameters := consentBody{}
+		err := context.Bind(&parameters)
+		if err != nil || len(parameters.Scopes) == 0 {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		client, err := entity.LoadClientFromID(service.realmDatabase(context), parameters.ClientID)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The client does not exist\"}"))
+		}
+
+		allowed := client.AllowedScopes(parameters.Scopes)
+		if len(allowed) != len(parameters.Scopes) {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The client is not allowed one or more of the scopes\"}"))
+		}
+
+		scopes, err := entity.LoadScopesFromNames(service.realmDatabase(context), allowed)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		err = entity.GrantConsent(service.DatabaseConnection, accountID, client.ID, scopes)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Consent granted\"}"))
+	})
+
+	consentGroup.DELETE("/:clientId", func(context echo.Context) error {
+		accountID, authorized := service.accountIDForConsent(context)
+		if !authorized {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		err := entity.RevokeConsent(service.DatabaseConnection, accountID, context.Param("clientId"))
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Consent revoked\"}"))
+	})
+}
+
+// accountIDForConsent returns the id of the account if the request carries a token that the account got for itself, consents cannot be managed with impersonation, exchanged, password change or third party tokens
+func (service *Service) accountIDForConsent(context echo.Context) (accountID string, authorized bool) {
+	claims, err := jwt.GetClaimsFromContextIfValid(&realmFromContext(context).PrivateKey.PublicKey, context)
+	if err != nil || claims.Get("act") != nil || claims.Get("token_use") == tokenUseExchange || claims.Get("token_use") == tokenUsePasswordChange {
+		return
+	}
+
+	if clientID, hasClient := claims.Get("azp").(string); hasClient {
+		client, err := entity.LoadClientFromID(service.realmDatabase(context), clientID)
+		if err != nil || !client.FirstParty {
+			return
+		}
+	}
+
+	accountID, _ = claims.Get("sub").(string)
+	authorized = accountID != ""
+	return
+}
+
+// claimScopes are the claims about the account that a token issued for a client only carries if it has been granted the scope with the same name
+var claimScopes = []string{"groups", "orgs", "attributes"}
+
+// generateClientAccessToken generates a token for the client where the scope claim contains the requested scopes that the client is allowed and the roles and permissions are narrowed to those granted by the scopes, unless the client is first party missingConsent lists the scopes that the account has to consent to before a token can be issued
+func (service *Service) generateClientAccessToken(realm *loadedRealm, account entity.Account, client entity.Client, requestedScopes []string) (token []byte, missingConsent []string, err error) {
+	realmDatabase := entity.InRealm(service.DatabaseConnection, realm.Realm.Name)
+	scopeNames := client.AllowedScopes(requestedScopes)
+
+	if !client.FirstParty {
+		var consented []string
+		consented, err = entity.LoadConsentedScopeNames(service.DatabaseConnection, account.ID, client.ID)
+		if err != nil {
+			return
+		}
+
+		for _, name := range scopeNames {
+			if !containsString(consented, name) {
+				missingConsent = append(missingConsent, name)
+			}
+		}
+
+		if len(missingConsent) > 0 {
+			return
+		}
+	}
+
+	effectiveRoles, claims, err := service.accessTokenClaims(realm, account)
+	if err != nil {
+		return
+	}
+
+	scopes, err := entity.LoadScopesFromNames(realmDatabase, scopeNames)
+	if err != nil {
+		return
+	}
+
+	scopeRoles := []string{}
+	for _, scope := range scopes {
+		scopeRoles = append(scopeRoles, scope.Roles...)
+	}
+
+	grantedRoles, _, err := entity.LoadEffectiveRolesAndPermissions(realmDatabase, scopeRoles)
+	if err != nil {
+		return
+	}
+
+	account.Roles = []string{}
+	for _, role := range effectiveRoles {
+		if containsString(grantedRoles, role) {
+			account.Roles = append(account.Roles, role)
+		}
+	}
+
+	_, permissions, err := entity.LoadEffectiveRolesAndPermissions(realmDatabase, account.Roles)
+	if err != nil {
+		return
+	}
+
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	for _, claim := range claimScopes {
+		if !containsString(scopeNames, claim) {
+			delete(claims, claim)
+		}
+	}
+
+	claims["permissions"] = permissions
+	claims["scope"] = strings.Join(scopeNames, " ")
+	claims["azp"] = client.ID
+
+	token, err = service.signToken(realm, &account, claims)
+	return
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+
+	return false
+}
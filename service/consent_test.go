@@ -0,0 +1,137 @@
+package service_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/mojlighetsministeriet/identity-provider/service"
+	"github.com/stretchr/testify/assert"
+)
+
+type testClient struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+// createTestClient creates a client through the API and returns its id and secret
+func createTestClient(test *testing.T, identityService *service.Service, administratorToken string, firstParty bool, scopes ...string) (client testClient) {
+	response := serveTestRequest(identityService, http.MethodPost, "/client", administratorToken, entity.Client{Name: "Calendar app", FirstParty: firstParty, Scopes: scopes})
+	assert.Equal(test, http.StatusCreated, response.Code)
+
+	err := json.Unmarshal(response.Body.Bytes(), &client)
+	assert.NoError(test, err)
+
+	return
+}
+
+func TestClientTokenRequiresConsent(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	administrator := createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	user := createTestAccount(test, identityService, entity.Account{Email: "user@example.com", Roles: []string{"user"}})
+	administratorToken := loginTestAccount(test, identityService, administrator.Email)
+	userToken := loginTestAccount(test, identityService, user.Email)
+
+	group := entity.Group{Name: "Editors", Roles: []string{"user"}}
+	err := identityService.DatabaseConnection.Create(&group).Error
+	assert.NoError(test, err)
+	err = group.AddMember(identityService.DatabaseConnection, user.ID)
+	assert.NoError(test, err)
+
+	for _, name := range []string{"calendar", "groups"} {
+		response := serveTestRequest(identityService, http.MethodPost, "/scope", administratorToken, entity.Scope{Name: name, Roles: []string{"user"}})
+		assert.Equal(test, http.StatusCreated, response.Code)
+	}
+
+	client := createTestClient(test, identityService, administratorToken, false, "calendar", "groups")
+
+	response := serveTestRequest(identityService, http.MethodPost, "/token", "", map[string]string{"email": user.Email, "password": testPassword, "client_id": client.ID, "scope": "calendar"})
+	assert.Equal(test, http.StatusForbidden, response.Code)
+
+	var consentRequired struct {
+		ClientID string   `json:"clientId"`
+		Scopes   []string `json:"scopes"`
+	}
+	err = json.Unmarshal(response.Body.Bytes(), &consentRequired)
+	assert.NoError(test, err)
+	assert.Equal(test, client.ID, consentRequired.ClientID)
+	assert.Equal(test, []string{"calendar"}, consentRequired.Scopes)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/consent", userToken, map[string]interface{}{"clientId": client.ID, "scopes": []string{"calendar"}})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", map[string]string{"email": user.Email, "password": testPassword, "client_id": client.ID, "scope": "calendar"})
+	assert.Equal(test, http.StatusCreated, response.Code)
+
+	claims := decodeTestToken(test, identityService, decodeTestTokenResponse(test, response.Body.Bytes()))
+	assert.Equal(test, "calendar", claims["scope"])
+	assert.Equal(test, client.ID, claims["azp"])
+	assert.Nil(test, claims["groups"])
+
+	// The groups claim is only given with the groups scope
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", map[string]string{"email": user.Email, "password": testPassword, "client_id": client.ID, "scope": "calendar groups"})
+	assert.Equal(test, http.StatusForbidden, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/consent", userToken, map[string]interface{}{"clientId": client.ID, "scopes": []string{"groups"}})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", map[string]string{"email": user.Email, "password": testPassword, "client_id": client.ID, "scope": "calendar groups"})
+	assert.Equal(test, http.StatusCreated, response.Code)
+
+	clientToken := decodeTestTokenResponse(test, response.Body.Bytes())
+	claims = decodeTestToken(test, identityService, clientToken)
+	assert.Equal(test, []interface{}{"Editors"}, claims["groups"])
+
+	// A third party token cannot be used to manage consents
+	response = serveTestRequest(identityService, http.MethodGet, "/consent", clientToken, nil)
+	assert.Equal(test, http.StatusUnauthorized, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodDelete, "/consent/"+client.ID, userToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token/renew", clientToken, nil)
+	assert.Equal(test, http.StatusUnauthorized, response.Code)
+}
+
+func TestFirstPartyClientHasToAuthenticate(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	administrator := createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	user := createTestAccount(test, identityService, entity.Account{Email: "user@example.com", Roles: []string{"user"}})
+	administratorToken := loginTestAccount(test, identityService, administrator.Email)
+
+	response := serveTestRequest(identityService, http.MethodPost, "/scope", administratorToken, entity.Scope{Name: "calendar", Roles: []string{"user"}})
+	assert.Equal(test, http.StatusCreated, response.Code)
+
+	client := createTestClient(test, identityService, administratorToken, true, "calendar")
+	assert.NotEqual(test, "", client.Secret)
+
+	tokenRequest := map[string]string{"email": user.Email, "password": testPassword, "client_id": client.ID}
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", tokenRequest)
+	assert.Equal(test, http.StatusUnauthorized, response.Code)
+
+	tokenRequest["client_secret"] = "not-the-secret"
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", tokenRequest)
+	assert.Equal(test, http.StatusUnauthorized, response.Code)
+
+	tokenRequest["client_secret"] = client.Secret
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", tokenRequest)
+	assert.Equal(test, http.StatusCreated, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/device/code", "", map[string]string{"client_id": client.ID})
+	assert.Equal(test, http.StatusBadRequest, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/device/code", "", map[string]string{"client_id": client.ID, "client_secret": client.Secret})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	// A new secret replaces the previous one
+	response = serveTestRequest(identityService, http.MethodPost, "/client/"+client.ID+"/secret", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", tokenRequest)
+	assert.Equal(test, http.StatusUnauthorized, response.Code)
+}
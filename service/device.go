@@ -0,0 +1,211 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+)
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+func (service *Service) deviceResource() {
+	deviceGroup := service.Router.Group("/device")
+
+	deviceGroup.POST("/code", func(context echo.Context) error {
+		type deviceCodeBody struct {
+			ClientID     string `json:"client_id" form:"client_id"`
+			ClientSecret string `json:"client_secret" form:"client_secret"`
+			Scope        string `json:"scope" form:"scope"`
+		}
+
+		parameters := deviceCodeBody{}
+		context.Bind(&parameters)
+
+		if parameters.ClientID != "" && !service.authenticateClient(context, parameters.ClientID, parameters.ClientSecret) {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"error\":\"invalid_client\"}"))
+		}
+
+		deviceCode, authorization, err := entity.CreateDeviceAuthorization(
+			service.DatabaseConnection,
+			realmFromContext(context).Realm.Name,
+			parameters.ClientID,
+			strings.Join(strings.Fields(parameters.Scope), " "),
+			service.DeviceCodeLifetime,
+			service.DevicePollInterval,
+		)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		verificationURI := serviceURLFromContext(context) + "/device/verify"
+
+		return context.JSON(http.StatusOK, struct {
+			DeviceCode              string `json:"device_code"`
+			UserCode                string `json:"user_code"`
+			VerificationURI         string `json:"verification_uri"`
+			VerificationURIComplete string `json:"verification_uri_complete"`
+			ExpiresIn               int    `json:"expires_in"`
+			Interval                int    `json:"interval"`
+		}{
+			DeviceCode:              deviceCode,
+			UserCode:                authorization.FormattedUserCode(),
+			VerificationURI:         verificationURI,
+			VerificationURIComplete: verificationURI + "?user_code=" + authorization.FormattedUserCode(),
+			ExpiresIn:               int(service.DeviceCodeLifetime.Seconds()),
+			Interval:                authorization.PollInterval,
+		})
+	})
+
+	deviceGroup.GET("/verify", func(context echo.Context) error {
+		_, authorized := service.accountIDForConsent(context)
+		if !authorized {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		authorization, err := entity.LoadPendingDeviceAuthorizationFromUserCode(service.realmDatabase(context), context.QueryParam("user_code"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"The code is invalid or has expired\"}"))
+		}
+
+		type deviceVerification struct {
+			UserCode   string     `json:"userCode"`
+			ClientID   string     `json:"clientId,omitempty"`
+			ClientName string     `json:"clientName,omitempty"`
+			Scopes     []string   `json:"scopes"`
+			ExpiresAt  *time.Time `json:"expiresAt"`
+		}
+
+		verification := deviceVerification{
+			UserCode:  authorization.FormattedUserCode(),
+			Scopes:    strings.Fields(authorization.Scope),
+			ExpiresAt: authorization.ExpiresAt,
+		}
+
+		if authorization.ClientID != "" {
+			client, err := entity.LoadClientFromID(service.realmDatabase(context), authorization.ClientID)
+			if err != nil {
+				return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"The code is invalid or has expired\"}"))
+			}
+
+			verification.ClientID = client.ID
+			verification.ClientName = client.Name
+			verification.Scopes = client.AllowedScopes(verification.Scopes)
+		}
+
+		return context.JSON(http.StatusOK, verification)
+	})
+
+	deviceGroup.POST("/verify", func(context echo.Context) error {
+		type verifyBody struct {
+			UserCode string `json:"userCode"`
+			Approve  bool   `json:"approve"`
+		}
+
+		accountID, authorized := service.accountIDForConsent(context)
+		if !authorized {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		parameters := verifyBody{}
+		err := context.Bind(&parameters)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		authorization, err := entity.LoadPendingDeviceAuthorizationFromUserCode(service.realmDatabase(context), parameters.UserCode)
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"The code is invalid or has expired\"}"))
+		}
+
+		if !parameters.Approve {
+			err = authorization.Deny(service.DatabaseConnection)
+			if err == entity.ErrDeviceAuthorizationNotPending {
+				return context.JSONBlob(http.StatusConflict, []byte("{\"message\":\"The device has already been approved or denied\"}"))
+			} else if err != nil {
+				service.Log.Error(err)
+				return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+			}
+
+			return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Device denied\"}"))
+		}
+
+		// Approving a device for a third party client is also consenting to the scopes that it requested
+		if authorization.ClientID != "" {
+			client, err := entity.LoadClientFromID(service.realmDatabase(context), authorization.ClientID)
+			if err != nil {
+				return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"The code is invalid or has expired\"}"))
+			}
+
+			if !client.FirstParty {
+				scopes, err := entity.LoadScopesFromNames(service.realmDatabase(context), client.AllowedScopes(strings.Fields(authorization.Scope)))
+				if err == nil {
+					err = entity.GrantConsent(service.DatabaseConnection, accountID, client.ID, scopes)
+				}
+				if err != nil {
+					service.Log.Error(err)
+					return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+				}
+			}
+		}
+
+		err = authorization.Approve(service.DatabaseConnection, accountID)
+		if err == entity.ErrDeviceAuthorizationNotPending {
+			return context.JSONBlob(http.StatusConflict, []byte("{\"message\":\"The device has already been approved or denied\"}"))
+		} else if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Device approved\"}"))
+	})
+}
+
+// redeemDeviceCode responds to a device that polls the token end point, with one of the errors from RFC 8628 until the account has approved the device and then once with an access token response
+func (service *Service) redeemDeviceCode(context echo.Context, deviceCode string, clientID string) error {
+	authorization, err := entity.LoadDeviceAuthorizationFromDeviceCode(service.realmDatabase(context), deviceCode)
+	if err != nil || authorization.ClientID != clientID {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"error\":\"invalid_grant\"}"))
+	}
+
+	if authorization.IsExpired() {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"error\":\"expired_token\"}"))
+	}
+
+	allowed, err := authorization.Poll(service.DatabaseConnection)
+	if err != nil {
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	if !allowed {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"error\":\"slow_down\"}"))
+	}
+
+	switch authorization.Status {
+	case entity.DeviceAuthorizationPending:
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"error\":\"authorization_pending\"}"))
+	case entity.DeviceAuthorizationDenied:
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"error\":\"access_denied\"}"))
+	}
+
+	redeemed, err := authorization.Redeem(service.DatabaseConnection)
+	if err != nil {
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	if !redeemed {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"error\":\"invalid_grant\"}"))
+	}
+
+	account, err := entity.LoadAccountFromID(service.realmDatabase(context), authorization.AccountID)
+	if err != nil || !account.CanAuthenticate() {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"error\":\"access_denied\"}"))
+	}
+
+	return service.respondWithToken(context, account, authorization.ClientID, strings.Fields(authorization.Scope), http.StatusForbidden, respondWithAccessTokenResponse)
+}
@@ -0,0 +1,145 @@
+package service_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/mojlighetsministeriet/identity-provider/service"
+	"github.com/stretchr/testify/assert"
+)
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+type deviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+}
+
+type deviceTokenResponse struct {
+	AccessToken            string `json:"access_token"`
+	TokenType              string `json:"token_type"`
+	ExpiresIn              int64  `json:"expires_in"`
+	PasswordChangeRequired bool   `json:"password_change_required"`
+}
+
+func decodeTestDeviceTokenResponse(test *testing.T, body string) (token deviceTokenResponse) {
+	err := json.Unmarshal([]byte(body), &token)
+	assert.NoError(test, err)
+
+	return
+}
+
+// startTestDeviceAuthorization requests a device code without a client and returns it
+func startTestDeviceAuthorization(test *testing.T, identityService *service.Service) (codes deviceCodeResponse) {
+	response := serveTestRequest(identityService, http.MethodPost, "/device/code", "", nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	err := json.Unmarshal(response.Body.Bytes(), &codes)
+	assert.NoError(test, err)
+
+	return
+}
+
+func pollTestDeviceCode(identityService *service.Service, deviceCode string) (status int, body string) {
+	response := serveTestRequest(identityService, http.MethodPost, "/token", "", map[string]string{"grant_type": deviceCodeGrantType, "device_code": deviceCode})
+	return response.Code, response.Body.String()
+}
+
+func TestDeviceAuthorization(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	// Let the device poll as often as it wants
+	identityService.DevicePollInterval = 0
+
+	user := createTestAccount(test, identityService, entity.Account{Email: "user@example.com", Roles: []string{"user"}})
+	userToken := loginTestAccount(test, identityService, user.Email)
+
+	codes := startTestDeviceAuthorization(test, identityService)
+
+	status, body := pollTestDeviceCode(identityService, codes.DeviceCode)
+	assert.Equal(test, http.StatusBadRequest, status)
+	assert.JSONEq(test, "{\"error\":\"authorization_pending\"}", body)
+
+	// The user is sent to a page that looks up the code where it was shown
+	assert.True(test, strings.HasSuffix(codes.VerificationURI, "/device/verify"))
+	assert.Equal(test, codes.VerificationURI+"?user_code="+codes.UserCode, codes.VerificationURIComplete)
+
+	response := serveTestRequest(identityService, http.MethodGet, strings.TrimPrefix(codes.VerificationURIComplete, "http://example.com"), userToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/device/verify", userToken, map[string]interface{}{"userCode": codes.UserCode, "approve": true})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/device/verify", userToken, map[string]interface{}{"userCode": codes.UserCode, "approve": true})
+	assert.Equal(test, http.StatusNotFound, response.Code)
+
+	status, body = pollTestDeviceCode(identityService, codes.DeviceCode)
+	assert.Equal(test, http.StatusOK, status)
+
+	token := decodeTestDeviceTokenResponse(test, body)
+	assert.Equal(test, "Bearer", token.TokenType)
+	assert.True(test, token.ExpiresIn > 0)
+	assert.False(test, token.PasswordChangeRequired)
+	assert.Equal(test, user.ID, decodeTestToken(test, identityService, token.AccessToken)["sub"])
+
+	// The device code can only be redeemed once
+	status, body = pollTestDeviceCode(identityService, codes.DeviceCode)
+	assert.Equal(test, http.StatusBadRequest, status)
+	assert.JSONEq(test, "{\"error\":\"invalid_grant\"}", body)
+}
+
+func TestDeviceAuthorizationDenied(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	identityService.DevicePollInterval = 0
+
+	user := createTestAccount(test, identityService, entity.Account{Email: "user@example.com", Roles: []string{"user"}})
+	userToken := loginTestAccount(test, identityService, user.Email)
+
+	codes := startTestDeviceAuthorization(test, identityService)
+
+	response := serveTestRequest(identityService, http.MethodPost, "/device/verify", "", map[string]interface{}{"userCode": codes.UserCode, "approve": true})
+	assert.Equal(test, http.StatusUnauthorized, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/device/verify", userToken, map[string]interface{}{"userCode": codes.UserCode, "approve": false})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	status, body := pollTestDeviceCode(identityService, codes.DeviceCode)
+	assert.Equal(test, http.StatusBadRequest, status)
+	assert.JSONEq(test, "{\"error\":\"access_denied\"}", body)
+}
+
+func TestDeviceAuthorizationRequiresPasswordChange(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	identityService.DevicePollInterval = 0
+
+	user := createTestAccount(test, identityService, entity.Account{Email: "user@example.com", Roles: []string{"user"}})
+	userToken := loginTestAccount(test, identityService, user.Email)
+
+	codes := startTestDeviceAuthorization(test, identityService)
+
+	response := serveTestRequest(identityService, http.MethodPost, "/device/verify", userToken, map[string]interface{}{"userCode": codes.UserCode, "approve": true})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	err := identityService.DatabaseConnection.Model(&user).UpdateColumn("must_change_password", true).Error
+	assert.NoError(test, err)
+
+	status, body := pollTestDeviceCode(identityService, codes.DeviceCode)
+	assert.Equal(test, http.StatusOK, status)
+
+	token := decodeTestDeviceTokenResponse(test, body)
+	assert.True(test, token.PasswordChangeRequired)
+
+	claims := decodeTestToken(test, identityService, token.AccessToken)
+	assert.Equal(test, "password-change", claims["token_use"])
+	assert.Equal(test, []interface{}{}, claims["roles"])
+}
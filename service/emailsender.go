@@ -0,0 +1,269 @@
+package service
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mojlighetsministeriet/utils/httprequest"
+)
+
+// ErrSMTPStartTLSUnsupported is returned when the SMTP server does not offer STARTTLS and the sender requires it
+var ErrSMTPStartTLSUnsupported = errors.New("The SMTP server does not support STARTTLS")
+
+// Email is a rendered email that is ready to be delivered, the body is HTML and the text is an optional plain text version of it (or the only content if the body is empty)
+type Email struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+	Text    string `json:"text,omitempty"`
+}
+
+// EmailSender delivers rendered emails
+type EmailSender interface {
+	Send(email Email) error
+}
+
+// HTTPEmailSender posts each email as JSON to an email service
+type HTTPEmailSender struct {
+	URL    string
+	Client *httprequest.JSONClient
+}
+
+// Send will post the email to the URL
+func (sender *HTTPEmailSender) Send(email Email) error {
+	return sender.Client.Post(sender.URL, email, nil)
+}
+
+// SMTPEmailSender delivers emails through an SMTP server, the connection is upgraded with STARTTLS when the server supports it (and must be unless AllowInsecure is set) and if a username is set it authenticates with PLAIN auth
+type SMTPEmailSender struct {
+	Host          string
+	Port          int
+	From          string
+	Username      string
+	Password      string
+	TLSConfig     *tls.Config
+	AllowInsecure bool
+	Timeout       time.Duration
+}
+
+// Send will deliver the email in a new connection to the SMTP server
+func (sender *SMTPEmailSender) Send(email Email) (err error) {
+	timeout := sender.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	connection, err := net.DialTimeout("tcp", net.JoinHostPort(sender.Host, strconv.Itoa(sender.Port)), timeout)
+	if err != nil {
+		return
+	}
+	connection.SetDeadline(time.Now().Add(timeout))
+
+	client, err := smtp.NewClient(connection, sender.Host)
+	if err != nil {
+		connection.Close()
+		return
+	}
+	defer client.Close()
+
+	if supported, _ := client.Extension("STARTTLS"); supported {
+		tlsConfig := &tls.Config{}
+		if sender.TLSConfig != nil {
+			tlsConfig = sender.TLSConfig.Clone()
+		}
+		tlsConfig.ServerName = sender.Host
+
+		err = client.StartTLS(tlsConfig)
+		if err != nil {
+			return
+		}
+	} else if !sender.AllowInsecure {
+		return ErrSMTPStartTLSUnsupported
+	}
+
+	if sender.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", sender.Username, sender.Password, sender.Host))
+		if err != nil {
+			return
+		}
+	}
+
+	err = client.Mail(sender.From)
+	if err != nil {
+		return
+	}
+
+	err = client.Rcpt(email.To)
+	if err != nil {
+		return
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return
+	}
+
+	err = writeMIMEMessage(writer, sender.From, email, time.Now())
+	if err != nil {
+		writer.Close()
+		return
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return
+	}
+
+	return client.Quit()
+}
+
+// writeMIMEMessage writes the email as a MIME message, with both a plain text and an HTML part if the email has both, the parts are quoted-printable
+func writeMIMEMessage(writer io.Writer, from string, email Email, date time.Time) (err error) {
+	headers := []string{
+		"From: " + from,
+		"To: " + email.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", email.Subject),
+		"Date: " + date.Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+	}
+
+	if email.Body == "" || email.Text == "" {
+		contentType, content := "text/html", email.Body
+		if email.Body == "" {
+			contentType, content = "text/plain", email.Text
+		}
+
+		_, err = io.WriteString(writer, strings.Join(headers, "\r\n")+"\r\n")
+		if err != nil {
+			return
+		}
+
+		return writeMIMEPart(writer, contentType, content)
+	}
+
+	parts := multipart.NewWriter(writer)
+	headers = append(headers, "Content-Type: multipart/alternative; boundary="+parts.Boundary())
+	_, err = io.WriteString(writer, strings.Join(headers, "\r\n")+"\r\n\r\n")
+	if err != nil {
+		return
+	}
+
+	// The preferred alternative comes last
+	for _, part := range []struct{ contentType, content string }{{"text/plain", email.Text}, {"text/html", email.Body}} {
+		var partWriter io.Writer
+		partWriter, err = parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return
+		}
+
+		body := quotedprintable.NewWriter(partWriter)
+		_, err = body.Write([]byte(part.content))
+		if err != nil {
+			return
+		}
+
+		err = body.Close()
+		if err != nil {
+			return
+		}
+	}
+
+	return parts.Close()
+}
+
+// writeMIMEPart writes the content type headers and the quoted-printable content
+func writeMIMEPart(writer io.Writer, contentType string, content string) (err error) {
+	_, err = io.WriteString(writer, "Content-Type: "+contentType+"; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+	if err != nil {
+		return
+	}
+
+	body := quotedprintable.NewWriter(writer)
+	_, err = body.Write([]byte(content))
+	if err != nil {
+		return
+	}
+
+	return body.Close()
+}
+
+// FileEmailSender writes each email as a line of JSON to a file, or to stdout if no path is set, instead of delivering it, which is meant for development and tests
+type FileEmailSender struct {
+	Path  string
+	mutex sync.Mutex
+}
+
+// Send will append the email to the file
+func (sender *FileEmailSender) Send(email Email) (err error) {
+	line, err := json.Marshal(struct {
+		Email
+		SentAt time.Time `json:"sentAt"`
+	}{email, time.Now()})
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	sender.mutex.Lock()
+	defer sender.mutex.Unlock()
+
+	if sender.Path == "" {
+		_, err = os.Stdout.Write(line)
+		return
+	}
+
+	file, err := os.OpenFile(sender.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+
+	_, err = file.Write(line)
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	return
+}
+
+// ReadEmailsFromFile returns the emails that a FileEmailSender has written to the file, the oldest first
+func ReadEmailsFromFile(path string) (emails []Email, err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	for _, line := range bytes.Split(content, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		email := Email{}
+		err = json.Unmarshal(line, &email)
+		if err != nil {
+			return
+		}
+
+		emails = append(emails, email)
+	}
+
+	return
+}
@@ -0,0 +1,127 @@
+package service_test
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mojlighetsministeriet/identity-provider/service"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileEmailSender(test *testing.T) {
+	path := "/tmp/identity-provider-test-" + uuid.Must(uuid.NewV4()).String() + ".jsonl"
+	defer os.Remove(path)
+
+	sender := &service.FileEmailSender{Path: path}
+	assert.NoError(test, sender.Send(service.Email{To: "first@example.com", Subject: "Första", Body: "<p>Hej</p>"}))
+	assert.NoError(test, sender.Send(service.Email{To: "second@example.com", Subject: "Second", Body: "<p>Hello</p>"}))
+
+	emails, err := service.ReadEmailsFromFile(path)
+	assert.NoError(test, err)
+	assert.Equal(test, []service.Email{
+		{To: "first@example.com", Subject: "Första", Body: "<p>Hej</p>"},
+		{To: "second@example.com", Subject: "Second", Body: "<p>Hello</p>"},
+	}, emails)
+}
+
+// fakeSMTPServer accepts one connection, answers every command with success and sends the commands and the message data that it received on the channel
+func fakeSMTPServer(test *testing.T, extensions []string) (port int, received chan []string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(test, err)
+	received = make(chan []string, 1)
+
+	go func() {
+		defer listener.Close()
+
+		connection, err := listener.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer connection.Close()
+
+		lines := []string{}
+		reader := bufio.NewReader(connection)
+		connection.Write([]byte("220 localhost ESMTP\r\n"))
+
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				received <- lines
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			lines = append(lines, line)
+
+			switch {
+			case strings.HasPrefix(line, "EHLO"):
+				response := "250-localhost\r\n"
+				for _, extension := range extensions {
+					response += "250-" + extension + "\r\n"
+				}
+				connection.Write([]byte(response + "250 OK\r\n"))
+			case line == "DATA":
+				connection.Write([]byte("354 Go ahead\r\n"))
+				for {
+					dataLine, err := reader.ReadString('\n')
+					if err != nil || dataLine == ".\r\n" {
+						break
+					}
+					lines = append(lines, strings.TrimRight(dataLine, "\r\n"))
+				}
+				connection.Write([]byte("250 OK\r\n"))
+			case line == "QUIT":
+				connection.Write([]byte("221 Bye\r\n"))
+				received <- lines
+				return
+			default:
+				connection.Write([]byte("250 OK\r\n"))
+			}
+		}
+	}()
+
+	port = listener.Addr().(*net.TCPAddr).Port
+	return
+}
+
+func TestSMTPEmailSender(test *testing.T) {
+	port, received := fakeSMTPServer(test, nil)
+
+	sender := &service.SMTPEmailSender{Host: "127.0.0.1", Port: port, From: "noreply@example.com", AllowInsecure: true}
+	err := sender.Send(service.Email{To: "user@example.com", Subject: "Välkommen", Body: "<p>Hej</p>"})
+	assert.NoError(test, err)
+
+	lines := strings.Join(<-received, "\n")
+	assert.Contains(test, lines, "MAIL FROM:<noreply@example.com>")
+	assert.Contains(test, lines, "RCPT TO:<user@example.com>")
+	assert.Contains(test, lines, "To: user@example.com")
+	assert.Contains(test, lines, "Subject: =?utf-8?q?V=C3=A4lkommen?=")
+	assert.Contains(test, lines, "Content-Type: text/html; charset=utf-8")
+	assert.Contains(test, lines, "<p>Hej</p>")
+}
+
+func TestSMTPEmailSenderWithTextAndHTML(test *testing.T) {
+	port, received := fakeSMTPServer(test, nil)
+
+	sender := &service.SMTPEmailSender{Host: "127.0.0.1", Port: port, From: "noreply@example.com", AllowInsecure: true}
+	err := sender.Send(service.Email{To: "user@example.com", Subject: "Hello", Body: "<p>Hello</p>", Text: "Hello"})
+	assert.NoError(test, err)
+
+	lines := strings.Join(<-received, "\n")
+	assert.Contains(test, lines, "Content-Type: multipart/alternative; boundary=")
+	assert.Contains(test, lines, "Content-Type: text/plain; charset=utf-8")
+	assert.Contains(test, lines, "Content-Type: text/html; charset=utf-8")
+	assert.True(test, strings.Index(lines, "text/plain") < strings.Index(lines, "text/html"))
+}
+
+func TestSMTPEmailSenderRequiresStartTLS(test *testing.T) {
+	port, _ := fakeSMTPServer(test, nil)
+
+	sender := &service.SMTPEmailSender{Host: "127.0.0.1", Port: port, From: "noreply@example.com"}
+	err := sender.Send(service.Email{To: "user@example.com", Subject: "Subject", Body: "Body"})
+	assert.Equal(test, service.ErrSMTPStartTLSUnsupported, err)
+}
@@ -0,0 +1,390 @@
+package service
+
+import (
+	htmltemplate "html/template"
+	"io/ioutil"
+	"net/http"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/mojlighetsministeriet/utils/emailtemplates"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// sampleEmailRecipient is the recipient of previewed emails
+const sampleEmailRecipient = "user@example.com"
+
+// emailTemplateFromRealm, emailTemplateFromDirectory and emailTemplateFromConfiguration tell where the template that is sent comes from, the realms own version, the template directory or the templates that the service was configured with
+const (
+	emailTemplateFromRealm         = "realm"
+	emailTemplateFromDirectory     = "directory"
+	emailTemplateFromConfiguration = "configuration"
+)
+
+// emailTemplateResponse is the email template that the realm sends in the locale, it comes from the source in the source locale. Customized is true when the realm has its own version in exactly the locale, which is the one that is changed or removed with the same locale. The text is the plain text version and is empty if the email has none.
+type emailTemplateResponse struct {
+	Name         string     `json:"name"`
+	Locale       string     `json:"locale,omitempty"`
+	Subject      string     `json:"subject"`
+	Body         string     `json:"body"`
+	Text         string     `json:"text,omitempty"`
+	Source       string     `json:"source"`
+	SourceLocale string     `json:"sourceLocale,omitempty"`
+	Customized   bool       `json:"customized"`
+	UpdatedAt    *time.Time `json:"updatedAt,omitempty"`
+}
+
+// defaultEmailTemplate returns the template with the name that the service was configured with
+func (service *Service) defaultEmailTemplate(name string) (template emailtemplates.Template, exists bool) {
+	for _, defaultTemplate := range service.defaultEmailTemplates {
+		if defaultTemplate.Name == name {
+			return defaultTemplate, true
+		}
+	}
+
+	return
+}
+
+// emailTemplateSampleData returns data of the same kind as the service renders the template with, exists is false for templates that the service does not know about
+func emailTemplateSampleData(name string, serviceURL string) (data interface{}, exists bool) {
+	exists = true
+
+	switch name {
+	case "new-account", "reset-password":
+		data = struct {
+			ServiceURL string
+			ResetToken string
+		}{serviceURL, "sample-reset-token"}
+	case "account-expiring":
+		data = struct {
+			Email     string
+			ExpiresAt time.Time
+		}{sampleEmailRecipient, time.Now().Add(7 * 24 * time.Hour)}
+	case "login-link":
+		data = struct {
+			ServiceURL string
+			LoginToken string
+		}{serviceURL, "sample-login-token"}
+	case "verify-email":
+		data = struct {
+			ServiceURL        string
+			VerificationToken string
+		}{serviceURL, "sample-verification-token"}
+	default:
+		exists = false
+	}
+
+	return
+}
+
+// checkEmailTemplate parses the subject, the body and the text and, if there is sample data for the template, renders them with it so that a template that uses data that it is never given is refused as well, field is subject, body or text depending on which one that failed
+func checkEmailTemplate(name string, subject string, body string, text string, serviceURL string) (field string, err error) {
+	field = "subject"
+	subjectTemplate, err := texttemplate.New(name + ".subject").Parse(subject)
+	if err != nil {
+		return
+	}
+
+	field = "body"
+	bodyTemplate, err := htmltemplate.New(name + ".body").Parse(body)
+	if err != nil {
+		return
+	}
+
+	field = "text"
+	textTemplate, err := texttemplate.New(name + ".text").Parse(text)
+	if err != nil {
+		return
+	}
+
+	data, exists := emailTemplateSampleData(name, serviceURL)
+	if !exists {
+		field = ""
+		return
+	}
+
+	field = "subject"
+	err = subjectTemplate.Execute(ioutil.Discard, data)
+	if err != nil {
+		return
+	}
+
+	field = "body"
+	err = bodyTemplate.Execute(ioutil.Discard, data)
+	if err != nil {
+		return
+	}
+
+	field = "text"
+	err = textTemplate.Execute(ioutil.Discard, data)
+	if err != nil {
+		return
+	}
+
+	field = ""
+	return
+}
+
+// emailTemplateLocale returns the locale query parameter that selects which version of the templates to use, an empty locale is the version for every locale
+func emailTemplateLocale(context echo.Context) (locale string, valid bool) {
+	locale = context.QueryParam("locale")
+	if !entity.IsValidLocale(locale) {
+		return
+	}
+
+	return normalizeLocale(locale), true
+}
+
+func respondWithInvalidEmailTemplate(context echo.Context, field string, err error) error {
+	return context.JSON(http.StatusBadRequest, struct {
+		Message string `json:"message"`
+		Field   string `json:"field"`
+		Error   string `json:"error"`
+	}{Message: "The email template is not valid", Field: field, Error: err.Error()})
+}
+
+func (service *Service) emailTemplateResource() {
+	emailTemplateGroup := service.Router.Group("/email-template")
+	canRead := service.requirePermission("email:read")
+	canWrite := service.requirePermission("email:write")
+
+	emailTemplateGroup.GET("", func(context echo.Context) error {
+		locale, valid := emailTemplateLocale(context)
+		if !valid {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The locale is not valid\"}"))
+		}
+
+		realmTemplates, err := service.loadRealmEmailTemplates(context)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		templates := []emailTemplateResponse{}
+		for _, defaultTemplate := range service.defaultEmailTemplates {
+			template, _ := service.resolveEmailTemplate(realmTemplates, defaultTemplate.Name, locale)
+			templates = append(templates, template)
+		}
+
+		return context.JSON(http.StatusOK, templates)
+	}, canRead)
+
+	emailTemplateGroup.GET("/:name", func(context echo.Context) error {
+		locale, valid := emailTemplateLocale(context)
+		if !valid {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The locale is not valid\"}"))
+		}
+
+		realmTemplates, err := service.loadRealmEmailTemplates(context)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		template, exists := service.resolveEmailTemplate(realmTemplates, context.Param("name"), locale)
+		if !exists {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		return context.JSON(http.StatusOK, template)
+	}, canRead)
+
+	emailTemplateGroup.PUT("/:name", func(context echo.Context) error {
+		name := context.Param("name")
+		if _, exists := service.defaultEmailTemplate(name); !exists {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		locale, valid := emailTemplateLocale(context)
+		if !valid {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The locale is not valid\"}"))
+		}
+
+		changes := entity.RealmEmailTemplate{}
+		err := context.Bind(&changes)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		template := entity.RealmEmailTemplate{
+			RealmName: realmFromContext(context).Realm.Name,
+			Name:      name,
+			Locale:    locale,
+			Subject:   changes.Subject,
+			Body:      changes.Body,
+			Text:      changes.Text,
+		}
+
+		validate := validator.New()
+		err = validate.Struct(template)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		field, err := checkEmailTemplate(template.Name, template.Subject, template.Body, template.Text, serviceURLFromContext(context))
+		if err != nil {
+			return respondWithInvalidEmailTemplate(context, field, err)
+		}
+
+		err = service.DatabaseConnection.Save(&template).Error
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		// Other replicas pick up the change the next time their realms are older than realmCacheLifetime
+		err = service.loadRealms()
+		if err != nil {
+			service.Log.Error(err)
+		}
+
+		return context.JSON(http.StatusOK, realmEmailTemplateResponse(template))
+	}, canWrite)
+
+	emailTemplateGroup.POST("/:name/preview", func(context echo.Context) error {
+		type previewBody struct {
+			Subject string `json:"subject"`
+			Body    string `json:"body"`
+			Text    string `json:"text"`
+		}
+
+		locale, valid := emailTemplateLocale(context)
+		if !valid {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The locale is not valid\"}"))
+		}
+
+		realmTemplates, err := service.loadRealmEmailTemplates(context)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		name := context.Param("name")
+		template, exists := service.resolveEmailTemplate(realmTemplates, name, locale)
+		if !exists {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		parameters := previewBody{}
+		context.Bind(&parameters)
+
+		// A template that is being edited can be previewed before it is saved, otherwise the template that is sent in the locale is previewed
+		if parameters.Subject != "" || parameters.Body != "" || parameters.Text != "" {
+			template.Subject = parameters.Subject
+			template.Body = parameters.Body
+			template.Text = parameters.Text
+		}
+
+		field, err := checkEmailTemplate(name, template.Subject, template.Body, template.Text, serviceURLFromContext(context))
+		if err != nil {
+			return respondWithInvalidEmailTemplate(context, field, err)
+		}
+
+		data, _ := emailTemplateSampleData(name, serviceURLFromContext(context))
+		email, err := renderEditedEmailTemplate(name, template.Subject, template.Body, template.Text, sampleEmailRecipient, data)
+		if err != nil {
+			return respondWithInvalidEmailTemplate(context, "", err)
+		}
+
+		return context.JSON(http.StatusOK, email)
+	}, canRead)
+
+	emailTemplateGroup.DELETE("/:name", func(context echo.Context) error {
+		name := context.Param("name")
+		if _, exists := service.defaultEmailTemplate(name); !exists {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		locale, valid := emailTemplateLocale(context)
+		if !valid {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The locale is not valid\"}"))
+		}
+
+		_, err := entity.DeleteRealmEmailTemplate(service.DatabaseConnection, realmFromContext(context).Realm.Name, name, locale)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		err = service.loadRealms()
+		if err != nil {
+			service.Log.Error(err)
+		}
+
+		// The response is the template that is sent in the locale from now on
+		realmTemplates, err := service.loadRealmEmailTemplates(context)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		template, _ := service.resolveEmailTemplate(realmTemplates, name, locale)
+		return context.JSON(http.StatusOK, template)
+	}, canWrite)
+}
+
+// loadRealmEmailTemplates reads the realms own templates from the database, instead of the cache of loadRealms, so that a change made through another replica is seen at once
+func (service *Service) loadRealmEmailTemplates(context echo.Context) (templates map[string]map[string]entity.RealmEmailTemplate, err error) {
+	realm, err := entity.LoadRealmFromName(service.DatabaseConnection, realmFromContext(context).Realm.Name)
+	if err != nil {
+		return
+	}
+
+	templates = realmEmailTemplatesByLocale(realm.EmailTemplates)
+	return
+}
+
+// resolveEmailTemplate returns the template that is sent with the name to an account with the locale, in each locale from localeFallbacks the realms own version comes before the template from the template directory, after them the realms own version for every locale is used and last the configured template. Exists is false if there is no template with the name.
+func (service *Service) resolveEmailTemplate(realmTemplates map[string]map[string]entity.RealmEmailTemplate, name string, locale string) (template emailTemplateResponse, exists bool) {
+	defaultLocale := ""
+	if service.LocalizedEmailTemplates != nil {
+		defaultLocale = service.LocalizedEmailTemplates.DefaultLocale
+	}
+
+	for _, candidate := range append(localeFallbacks(locale, defaultLocale), "") {
+		if realmTemplate, found := realmTemplates[candidate][name]; found {
+			template = realmEmailTemplateResponse(realmTemplate)
+			template.Locale = locale
+			template.Customized = realmTemplate.Locale == locale
+			return template, true
+		}
+
+		if candidate != "" && service.LocalizedEmailTemplates != nil {
+			if localizedTemplate, found := service.LocalizedEmailTemplates.template(name, candidate); found {
+				template = emailTemplateResponse{
+					Name:         name,
+					Locale:       locale,
+					Subject:      localizedTemplate.SubjectSource,
+					Body:         localizedTemplate.HTMLSource,
+					Text:         localizedTemplate.TextSource,
+					Source:       emailTemplateFromDirectory,
+					SourceLocale: candidate,
+				}
+				return template, true
+			}
+		}
+	}
+
+	defaultTemplate, exists := service.defaultEmailTemplate(name)
+	if exists {
+		template = emailTemplateResponse{Name: name, Locale: locale, Subject: defaultTemplate.Subject, Body: defaultTemplate.Body, Source: emailTemplateFromConfiguration}
+	}
+
+	return
+}
+
+func realmEmailTemplateResponse(template entity.RealmEmailTemplate) emailTemplateResponse {
+	return emailTemplateResponse{
+		Name:         template.Name,
+		Locale:       template.Locale,
+		Subject:      template.Subject,
+		Body:         template.Body,
+		Text:         template.Text,
+		Source:       emailTemplateFromRealm,
+		SourceLocale: template.Locale,
+		Customized:   true,
+		UpdatedAt:    template.UpdatedAt,
+	}
+}
@@ -0,0 +1,292 @@
+package service_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/mojlighetsministeriet/identity-provider/service"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type testEmailTemplate struct {
+	Name         string `json:"name"`
+	Locale       string `json:"locale"`
+	Subject      string `json:"subject"`
+	Body         string `json:"body"`
+	Text         string `json:"text"`
+	Source       string `json:"source"`
+	SourceLocale string `json:"sourceLocale"`
+	Customized   bool   `json:"customized"`
+}
+
+func decodeTestEmailTemplate(test *testing.T, body []byte) (template testEmailTemplate) {
+	err := json.Unmarshal(body, &template)
+	assert.NoError(test, err)
+
+	return
+}
+
+func TestEmailTemplateIsEditedPerLocale(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	administrator := createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	administratorToken := loginTestAccount(test, identityService, administrator.Email)
+
+	response := serveTestRequest(identityService, http.MethodGet, "/email-template", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	var templates []testEmailTemplate
+	err := json.Unmarshal(response.Body.Bytes(), &templates)
+	assert.NoError(test, err)
+	assert.Equal(test, []testEmailTemplate{
+		{Name: "new-account", Subject: "Welcome", Body: "<a href=\"{{.ServiceURL}}/reset-password?token={{.ResetToken}}\">Choose a password</a>", Source: "configuration"},
+		{Name: "reset-password", Subject: "Reset your password", Body: "<a href=\"{{.ServiceURL}}/reset-password?token={{.ResetToken}}\">Choose a new password</a>", Source: "configuration"},
+		{Name: "login-link", Subject: "Log in", Body: "<a href=\"{{.ServiceURL}}/login?token={{.LoginToken}}\">Log in</a>", Source: "configuration"},
+		{Name: "verify-email", Subject: "Verify your email", Body: "<a href=\"{{.ServiceURL}}/verify-email?token={{.VerificationToken}}\">Verify your email</a>", Source: "configuration"},
+	}, templates)
+
+	response = serveTestRequest(identityService, http.MethodGet, "/email-template/unknown", administratorToken, nil)
+	assert.Equal(test, http.StatusNotFound, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodGet, "/email-template/login-link?locale=not+a+locale", administratorToken, nil)
+	assert.Equal(test, http.StatusBadRequest, response.Code)
+
+	edited := map[string]string{"subject": "Logga in", "body": "<a href=\"{{.ServiceURL}}/login?token={{.LoginToken}}\">Logga in</a>"}
+	response = serveTestRequest(identityService, http.MethodPut, "/email-template/login-link?locale=sv", administratorToken, edited)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	template := decodeTestEmailTemplate(test, response.Body.Bytes())
+	assert.Equal(test, "sv", template.Locale)
+	assert.Equal(test, "Logga in", template.Subject)
+	assert.True(test, template.Customized)
+
+	response = serveTestRequest(identityService, http.MethodGet, "/email-template/login-link?locale=sv", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+	assert.Equal(test, template, decodeTestEmailTemplate(test, response.Body.Bytes()))
+
+	// The other locales still use the configured template
+	response = serveTestRequest(identityService, http.MethodGet, "/email-template/login-link", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+	template = decodeTestEmailTemplate(test, response.Body.Bytes())
+	assert.Equal(test, "Log in", template.Subject)
+	assert.False(test, template.Customized)
+
+	// Changing the realm keeps the templates
+	response = serveTestRequest(identityService, http.MethodGet, "/realm/"+entity.DefaultRealm, administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	var realm map[string]interface{}
+	err = json.Unmarshal(response.Body.Bytes(), &realm)
+	assert.NoError(test, err)
+
+	response = serveTestRequest(identityService, http.MethodPut, "/realm/"+entity.DefaultRealm, administratorToken, map[string]interface{}{"host": realm["host"], "emailTemplates": []interface{}{}})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodGet, "/email-template/login-link?locale=sv", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+	assert.True(test, decodeTestEmailTemplate(test, response.Body.Bytes()).Customized)
+
+	response = serveTestRequest(identityService, http.MethodDelete, "/email-template/login-link?locale=sv", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	template = decodeTestEmailTemplate(test, response.Body.Bytes())
+	assert.Equal(test, "Log in", template.Subject)
+	assert.False(test, template.Customized)
+
+	response = serveTestRequest(identityService, http.MethodGet, "/email-template/login-link?locale=sv", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+	assert.False(test, decodeTestEmailTemplate(test, response.Body.Bytes()).Customized)
+}
+
+func TestEmailTemplateIsChecked(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	administrator := createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	administratorToken := loginTestAccount(test, identityService, administrator.Email)
+
+	type invalidTemplate struct {
+		Message string `json:"message"`
+		Field   string `json:"field"`
+	}
+
+	for _, example := range []struct {
+		subject string
+		body    string
+		field   string
+	}{
+		{"Log in", "<a href=\"{{.ServiceURL}}/login?token={{.LoginToken\">Log in</a>", "body"},
+		{"Log in", "<a href=\"{{.ServiceURL}}/login?token={{.Unknown}}\">Log in</a>", "body"},
+		{"{{if .LoginToken}}Log in", "<a href=\"{{.ServiceURL}}/login?token={{.LoginToken}}\">Log in</a>", "subject"},
+		{"Log in as {{.Email}}", "<a href=\"{{.ServiceURL}}/login?token={{.LoginToken}}\">Log in</a>", "subject"},
+		{"Log in", "<a href=\"{{.ServiceURL}}/login?token={{.LoginToken}}\">Log in</a>", "text"},
+	} {
+		for _, path := range []string{"/email-template/login-link", "/email-template/login-link/preview"} {
+			method := http.MethodPut
+			if path != "/email-template/login-link" {
+				method = http.MethodPost
+			}
+
+			// The text is only invalid in the example where it is the field that fails
+			text := "Log in at {{.ServiceURL}}/login?token={{.LoginToken}}"
+			if example.field == "text" {
+				text = "Log in at {{.ServiceURL}}/login?token={{.Unknown}}"
+			}
+
+			response := serveTestRequest(identityService, method, path, administratorToken, map[string]string{"subject": example.subject, "body": example.body, "text": text})
+			assert.Equal(test, http.StatusBadRequest, response.Code)
+
+			result := invalidTemplate{}
+			err := json.Unmarshal(response.Body.Bytes(), &result)
+			assert.NoError(test, err)
+			assert.Equal(test, invalidTemplate{Message: "The email template is not valid", Field: example.field}, result)
+		}
+	}
+
+	response := serveTestRequest(identityService, http.MethodGet, "/email-template/login-link", administratorToken, nil)
+	assert.False(test, decodeTestEmailTemplate(test, response.Body.Bytes()).Customized)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/email-template/login-link/preview", administratorToken, map[string]string{"subject": "Log in to {{.ServiceURL}}", "body": "<a href=\"{{.ServiceURL}}/login?token={{.LoginToken}}\">Log in</a>"})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	var preview struct {
+		To      string `json:"to"`
+		Subject string `json:"subject"`
+		Body    string `json:"body"`
+	}
+	err := json.Unmarshal(response.Body.Bytes(), &preview)
+	assert.NoError(test, err)
+	assert.Equal(test, "user@example.com", preview.To)
+	assert.Contains(test, preview.Body, "token=sample-login-token")
+}
+
+func TestEditedEmailTemplateIsSent(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	administrator := createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	administratorToken := loginTestAccount(test, identityService, administrator.Email)
+	createTestAccount(test, identityService, entity.Account{Email: "swedish@example.com", Roles: []string{"user"}, Locale: "sv-SE"})
+	createTestAccount(test, identityService, entity.Account{Email: "english@example.com", Roles: []string{"user"}, Locale: "en"})
+
+	response := serveTestRequest(identityService, http.MethodPut, "/email-template/login-link?locale=sv", administratorToken, map[string]string{"subject": "Logga in", "body": "<a href=\"{{.ServiceURL}}/login?token={{.LoginToken}}\">Logga in</a>"})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token/email-link", "", map[string]string{"email": "swedish@example.com"})
+	assert.Equal(test, http.StatusOK, response.Code)
+	assert.Equal(test, "Logga in", latestTestEmail(test, identityService, "swedish@example.com").Subject)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token/email-link", "", map[string]string{"email": "english@example.com"})
+	assert.Equal(test, http.StatusOK, response.Code)
+	assert.Equal(test, "Log in", latestTestEmail(test, identityService, "english@example.com").Subject)
+
+	// The version without a locale is used for every locale that has no version of its own
+	response = serveTestRequest(identityService, http.MethodPut, "/email-template/login-link", administratorToken, map[string]string{"subject": "Sign in", "body": "<a href=\"{{.ServiceURL}}/login?token={{.LoginToken}}\">Sign in</a>"})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token/email-link", "", map[string]string{"email": "english@example.com"})
+	assert.Equal(test, http.StatusOK, response.Code)
+	assert.Equal(test, "Sign in", latestTestEmail(test, identityService, "english@example.com").Subject)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token/email-link", "", map[string]string{"email": "swedish@example.com"})
+	assert.Equal(test, http.StatusOK, response.Code)
+	assert.Equal(test, "Logga in", latestTestEmail(test, identityService, "swedish@example.com").Subject)
+}
+
+func TestEmailTemplateIsTheOneThatIsSent(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	directory := "/tmp/identity-provider-test-" + uuid.Must(uuid.NewV4()).String()
+	defer os.RemoveAll(directory)
+
+	for file, content := range map[string]string{
+		"login-link.subject": "Din inloggningslänk",
+		"login-link.html":    "<a href=\"{{.ServiceURL}}/login?token={{.LoginToken}}\">Logga in</a>",
+		"login-link.txt":     "Logga in på {{.ServiceURL}}/login?token={{.LoginToken}}",
+	} {
+		err := os.MkdirAll(filepath.Join(directory, "sv"), 0700)
+		assert.NoError(test, err)
+		err = ioutil.WriteFile(filepath.Join(directory, "sv", file), []byte(content), 0600)
+		assert.NoError(test, err)
+	}
+
+	localizedEmailTemplates, err := service.LoadLocalizedEmailTemplates(directory, "en")
+	assert.NoError(test, err)
+	identityService.LocalizedEmailTemplates = localizedEmailTemplates
+
+	administrator := createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	administratorToken := loginTestAccount(test, identityService, administrator.Email)
+	createTestAccount(test, identityService, entity.Account{Email: "finnish-swede@example.com", Roles: []string{"user"}, Locale: "sv-FI"})
+
+	// An account in Finland that speaks Swedish gets the Swedish template from the directory
+	response := serveTestRequest(identityService, http.MethodGet, "/email-template/login-link?locale=sv-FI", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+	assert.Equal(test, testEmailTemplate{
+		Name:         "login-link",
+		Locale:       "sv-fi",
+		Subject:      "Din inloggningslänk",
+		Body:         "<a href=\"{{.ServiceURL}}/login?token={{.LoginToken}}\">Logga in</a>",
+		Text:         "Logga in på {{.ServiceURL}}/login?token={{.LoginToken}}",
+		Source:       "directory",
+		SourceLocale: "sv",
+	}, decodeTestEmailTemplate(test, response.Body.Bytes()))
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token/email-link", "", map[string]string{"email": "finnish-swede@example.com"})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	email := latestTestEmail(test, identityService, "finnish-swede@example.com")
+	assert.Equal(test, "Din inloggningslänk", email.Subject)
+	assert.Contains(test, email.TextBody, "Logga in på")
+
+	response = serveTestRequest(identityService, http.MethodPost, "/email-template/login-link/preview?locale=sv-FI", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	var preview struct {
+		Subject string `json:"subject"`
+		Text    string `json:"text"`
+	}
+	err = json.Unmarshal(response.Body.Bytes(), &preview)
+	assert.NoError(test, err)
+	assert.Equal(test, "Din inloggningslänk", preview.Subject)
+	assert.Contains(test, preview.Text, "token=sample-login-token")
+
+	// The realms own version comes before the directory and keeps its plain text part
+	response = serveTestRequest(identityService, http.MethodPut, "/email-template/login-link?locale=sv", administratorToken, map[string]string{
+		"subject": "Logga in",
+		"body":    "<a href=\"{{.ServiceURL}}/login?token={{.LoginToken}}\">Logga in här</a>",
+		"text":    "Logga in här: {{.ServiceURL}}/login?token={{.LoginToken}}",
+	})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodGet, "/email-template/login-link?locale=sv-FI", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	template := decodeTestEmailTemplate(test, response.Body.Bytes())
+	assert.Equal(test, "realm", template.Source)
+	assert.Equal(test, "sv", template.SourceLocale)
+	assert.Equal(test, "Logga in här: {{.ServiceURL}}/login?token={{.LoginToken}}", template.Text)
+	assert.False(test, template.Customized)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token/email-link", "", map[string]string{"email": "finnish-swede@example.com"})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	email = latestTestEmail(test, identityService, "finnish-swede@example.com")
+	assert.Equal(test, "Logga in", email.Subject)
+	assert.Contains(test, email.TextBody, "Logga in här: ")
+
+	// Removing the realms own version shows the directory template that is sent again
+	response = serveTestRequest(identityService, http.MethodDelete, "/email-template/login-link?locale=sv", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	template = decodeTestEmailTemplate(test, response.Body.Bytes())
+	assert.Equal(test, "directory", template.Source)
+	assert.Equal(test, "Din inloggningslänk", template.Subject)
+}
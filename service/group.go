@@ -0,0 +1,187 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+func (service *Service) groupResource() {
+	groupGroup := service.Router.Group("/group")
+	canRead := service.requirePermission("group:read")
+	canWrite := service.requirePermission("group:write")
+
+	groupGroup.GET("", func(context echo.Context) error {
+		groups, err := entity.LoadGroups(service.realmDatabase(context))
+		if err == nil {
+			return context.JSON(http.StatusOK, groups)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canRead)
+
+	groupGroup.POST("", func(context echo.Context) error {
+		group := entity.Group{}
+		err := context.Bind(&group)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		group.ID = ""
+		group.RealmID = realmFromContext(context).Realm.Name
+		group.BeforeSave()
+
+		return service.saveGroup(context, group, true)
+	}, canWrite)
+
+	groupGroup.GET("/:id", func(context echo.Context) error {
+		group, err := entity.LoadGroupFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		return context.JSON(http.StatusOK, group)
+	}, canRead)
+
+	groupGroup.PUT("/:id", func(context echo.Context) error {
+		group, err := entity.LoadGroupFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		changes := entity.Group{}
+		err = context.Bind(&changes)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		group.Name = changes.Name
+		group.Description = changes.Description
+		group.Roles = changes.Roles
+
+		return service.saveGroup(context, group, false)
+	}, canWrite)
+
+	groupGroup.DELETE("/:id", func(context echo.Context) error {
+		group, err := entity.LoadGroupFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		err = group.Delete(service.DatabaseConnection)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Deleted\"}"))
+	}, canWrite)
+
+	groupGroup.GET("/:id/members", func(context echo.Context) error {
+		group, err := entity.LoadGroupFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		page, err := getPaginationFromContext(context)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\""+err.Error()+"\"}"))
+		}
+
+		accounts, total, err := entity.LoadAccounts(service.realmDatabase(context), entity.AccountQuery{GroupID: group.ID, Offset: page.Offset(), Limit: page.PerPage})
+		if err == nil {
+			if accounts == nil {
+				accounts = []entity.Account{}
+			}
+
+			setPaginationHeaders(context, page, total)
+			return context.JSON(http.StatusOK, accounts)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canRead, service.requirePermission("account:read"))
+
+	groupGroup.POST("/:id/members", func(context echo.Context) error {
+		type memberBody struct {
+			AccountID string `json:"accountId"`
+		}
+
+		parameters := memberBody{}
+		context.Bind(&parameters)
+
+		group, err := entity.LoadGroupFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		account, err := entity.LoadAccountFromID(service.realmDatabase(context), parameters.AccountID)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The account does not exist\"}"))
+		}
+
+		err = group.AddMember(service.DatabaseConnection, account.ID)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Member added\"}"))
+	}, canWrite)
+
+	groupGroup.DELETE("/:id/members/:accountId", func(context echo.Context) error {
+		group, err := entity.LoadGroupFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		err = group.RemoveMember(service.DatabaseConnection, context.Param("accountId"))
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Member removed\"}"))
+	}, canWrite)
+}
+
+func (service *Service) saveGroup(context echo.Context, group entity.Group, isNew bool) error {
+	validate := validator.New()
+	err := validate.Struct(group)
+	if err != nil {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+	}
+
+	_, err = entity.LoadRolesFromNames(service.realmDatabase(context), group.Roles)
+	if err == entity.ErrUnknownRole {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"One or more of the roles does not exist\"}"))
+	} else if err != nil {
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	if isNew {
+		err = service.DatabaseConnection.Create(&group).Error
+	} else {
+		err = service.DatabaseConnection.Save(&group).Error
+	}
+	if err != nil {
+		// TODO: handle for non-MySQL databases as well
+		if strings.HasPrefix(err.Error(), "Error 1062") {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The name was already taken\"}"))
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	if isNew {
+		return context.JSON(http.StatusCreated, group)
+	}
+
+	return context.JSON(http.StatusOK, group)
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/mojlighetsministeriet/utils/jwt"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+func (service *Service) impersonationResource() {
+	impersonationGroup := service.Router.Group("/impersonation")
+	canImpersonate := service.requirePermission("account:impersonate")
+
+	service.Router.POST("/account/:id/impersonate", func(context echo.Context) error {
+		type impersonateBody struct {
+			Reason string `json:"reason" validate:"max=255"`
+		}
+
+		claims, err := jwt.GetClaimsFromContextIfValid(&realmFromContext(context).PrivateKey.PublicKey, context)
+		if err != nil {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		if claims.Get("act") != nil {
+			return context.JSONBlob(http.StatusForbidden, []byte("{\"message\":\"An impersonated account cannot impersonate other accounts\"}"))
+		}
+
+		parameters := impersonateBody{}
+		err = context.Bind(&parameters)
+		if err != nil || validator.New().Struct(parameters) != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		actorID, _ := claims.Get("sub").(string)
+		if actorID == context.Param("id") {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"You cannot impersonate your own account\"}"))
+		}
+
+		account, err := entity.LoadAccountFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil || !account.CanAuthenticate() {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		realm := realmFromContext(context)
+		effectiveRoles, accountClaims, err := service.accessTokenClaims(realm, account)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		for _, role := range effectiveRoles {
+			if role == "administrator" {
+				return context.JSONBlob(http.StatusForbidden, []byte("{\"message\":\"Administrators cannot be impersonated\"}"))
+			}
+		}
+
+		expiresAt := time.Now().Add(service.ImpersonationLifetime)
+		impersonation := entity.Impersonation{
+			RealmID:   realm.Realm.Name,
+			ActorID:   actorID,
+			AccountID: account.ID,
+			Reason:    parameters.Reason,
+			ExpiresAt: &expiresAt,
+		}
+
+		err = service.DatabaseConnection.Create(&impersonation).Error
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		service.Log.Info(fmt.Sprintf("Account %s started impersonating account %s in realm %s until %s (impersonation %s), reason: %s", actorID, account.ID, realm.Realm.Name, expiresAt.Format(time.RFC3339), impersonation.ID, impersonation.Reason))
+
+		accountClaims["act"] = map[string]string{"sub": actorID}
+		accountClaims["jti"] = impersonation.ID
+		accountClaims["exp"] = expiresAt.Unix()
+
+		account.Roles = effectiveRoles
+		token, err := service.signToken(realm, &account, accountClaims)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSON(http.StatusCreated, struct {
+			Token         string               `json:"token"`
+			Impersonation entity.Impersonation `json:"impersonation"`
+		}{Token: string(token), Impersonation: impersonation})
+	}, canImpersonate)
+
+	impersonationGroup.GET("", func(context echo.Context) error {
+		impersonations, err := entity.LoadImpersonations(service.realmDatabase(context))
+		if err == nil {
+			return context.JSON(http.StatusOK, impersonations)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canImpersonate)
+
+	impersonationGroup.DELETE("/:id", func(context echo.Context) error {
+		claims, err := jwt.GetClaimsFromContextIfValid(&realmFromContext(context).PrivateKey.PublicKey, context)
+		if err != nil {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		impersonation, err := entity.LoadImpersonationFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		if impersonation.RevokedAt == nil {
+			revokedBy, _ := claims.Get("sub").(string)
+			err = impersonation.Revoke(service.DatabaseConnection, revokedBy)
+			if err != nil {
+				service.Log.Error(err)
+				return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+			}
+
+			service.Log.Info(fmt.Sprintf("Account %s revoked impersonation %s of account %s by account %s", revokedBy, impersonation.ID, impersonation.AccountID, impersonation.ActorID))
+		}
+
+		return context.JSON(http.StatusOK, impersonation)
+	}, canImpersonate)
+}
+
+// isRevokedImpersonation returns true if the claims belong to an impersonation token that has been revoked
+func (service *Service) isRevokedImpersonation(claims interface {
+	Get(key string) interface{}
+}) bool {
+	if claims.Get("act") == nil {
+		return false
+	}
+
+	id, _ := claims.Get("jti").(string)
+	return entity.IsImpersonationRevoked(service.DatabaseConnection, id)
+}
@@ -0,0 +1,67 @@
+package service_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImpersonation(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	administrator := createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	otherAdministrator := createTestAccount(test, identityService, entity.Account{Email: "other@example.com", Roles: []string{"user", "administrator"}})
+	user := createTestAccount(test, identityService, entity.Account{Email: "user@example.com", Roles: []string{"user"}})
+	administratorToken := loginTestAccount(test, identityService, administrator.Email)
+	userToken := loginTestAccount(test, identityService, user.Email)
+
+	response := serveTestRequest(identityService, http.MethodPost, "/account/"+user.ID+"/impersonate", userToken, map[string]string{"reason": "Support case"})
+	assert.Equal(test, http.StatusForbidden, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/account/"+otherAdministrator.ID+"/impersonate", administratorToken, map[string]string{"reason": "Support case"})
+	assert.Equal(test, http.StatusForbidden, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/account/"+administrator.ID+"/impersonate", administratorToken, map[string]string{"reason": "Support case"})
+	assert.Equal(test, http.StatusBadRequest, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/account/"+user.ID+"/impersonate", administratorToken, map[string]string{"reason": "Support case"})
+	assert.Equal(test, http.StatusCreated, response.Code)
+
+	var impersonation struct {
+		Token         string               `json:"token"`
+		Impersonation entity.Impersonation `json:"impersonation"`
+	}
+	err := json.Unmarshal(response.Body.Bytes(), &impersonation)
+	assert.NoError(test, err)
+	assert.Equal(test, "Support case", impersonation.Impersonation.Reason)
+
+	claims := decodeTestToken(test, identityService, impersonation.Token)
+	assert.Equal(test, user.ID, claims["sub"])
+	assert.Equal(test, map[string]interface{}{"sub": administrator.ID}, claims["act"])
+	assert.Equal(test, impersonation.Impersonation.ID, claims["jti"])
+
+	// Impersonation tokens are short-lived on purpose and cannot be renewed or used to manage consents
+	response = serveTestRequest(identityService, http.MethodPost, "/token/renew", impersonation.Token, nil)
+	assert.Equal(test, http.StatusUnauthorized, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodGet, "/consent", impersonation.Token, nil)
+	assert.Equal(test, http.StatusUnauthorized, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodGet, "/impersonation", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	var impersonations []entity.Impersonation
+	err = json.Unmarshal(response.Body.Bytes(), &impersonations)
+	assert.NoError(test, err)
+	assert.Equal(test, 1, len(impersonations))
+
+	response = serveTestRequest(identityService, http.MethodDelete, "/impersonation/"+impersonation.Impersonation.ID, administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token/decode", impersonation.Token, nil)
+	assert.Equal(test, http.StatusUnauthorized, response.Code)
+}
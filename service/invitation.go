@@ -0,0 +1,137 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/mojlighetsministeriet/utils/jwt"
+)
+
+func (service *Service) invitationResource() {
+	invitationGroup := service.Router.Group("/invitation")
+	canRead := service.requirePermission("account:read")
+	canWrite := service.requirePermission("account:write")
+
+	invitationGroup.GET("", func(context echo.Context) error {
+		status := context.QueryParam("status")
+		if !entity.IsValidInvitationStatus(status) {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The status must be one of pending, accepted, expired or revoked\"}"))
+		}
+
+		invitations, err := entity.LoadInvitations(service.realmDatabase(context), status)
+		if err == nil {
+			if invitations == nil {
+				invitations = []entity.Invitation{}
+			}
+
+			return context.JSON(http.StatusOK, invitations)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canRead)
+
+	invitationGroup.POST("/:id/resend", func(context echo.Context) error {
+		invitation, err := entity.LoadInvitationFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		if !invitation.IsOpen() {
+			return context.JSONBlob(http.StatusConflict, []byte("{\"message\":\"The invitation has already been accepted or revoked\"}"))
+		}
+
+		// The invitation is sent in the locale of the account if it has one
+		account, _ := entity.LoadAccountFromID(service.realmDatabase(context), invitation.AccountID)
+
+		err = service.inTransaction(func(transaction *gorm.DB) error {
+			return service.sendInvitation(context, transaction, &invitation, account.Locale)
+		})
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSON(http.StatusOK, invitation)
+	}, canWrite)
+
+	invitationGroup.DELETE("/:id", func(context echo.Context) error {
+		invitation, err := entity.LoadInvitationFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		if !invitation.IsOpen() {
+			return context.JSONBlob(http.StatusConflict, []byte("{\"message\":\"The invitation has already been accepted or revoked\"}"))
+		}
+
+		err = invitation.Revoke(service.DatabaseConnection)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		// The account only existed for the invitation, it is deleted like any other account so that it can be restored
+		account, err := entity.LoadAccountFromID(service.realmDatabase(context), invitation.AccountID)
+		if err == nil {
+			err = service.DatabaseConnection.Delete(&account).Error
+			if err != nil {
+				service.Log.Error(err)
+				return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+			}
+		}
+
+		return context.JSON(http.StatusOK, invitation)
+	}, canWrite)
+}
+
+// sendInvitation gives the invitation a new token that is valid for seven days, makes it the reset token of the account so that the invitee can choose a password with it and queues it with the new-account email template in the locale, all with the database connection so that it can be done in a transaction
+func (service *Service) sendInvitation(context echo.Context, databaseConnection *gorm.DB, invitation *entity.Invitation, locale string) (err error) {
+	realm := realmFromContext(context)
+	expiration := time.Now().Add(time.Duration(3600*24*7) * time.Second)
+
+	invitationToken, err := jwt.GenerateWithCustomExpiration(
+		realm.Realm.Issuer(),
+		realm.PrivateKey,
+		&entity.Account{Email: invitation.Email},
+		expiration,
+	)
+	if err != nil {
+		return
+	}
+
+	account := entity.Account{ID: invitation.AccountID}
+	err = account.SetPasswordResetToken(string(invitationToken))
+	if err != nil {
+		return
+	}
+
+	err = databaseConnection.Model(&account).UpdateColumn("password_reset_token", account.PasswordResetToken).Error
+	if err != nil {
+		return
+	}
+
+	// Save does not give a new invitation an id in gorm so it is given one before
+	invitation.BeforeSave()
+	invitation.SetToken(string(invitationToken), expiration)
+	err = databaseConnection.Save(invitation).Error
+	if err != nil {
+		return
+	}
+
+	err = service.queueEmail(
+		databaseConnection,
+		realm,
+		"new-account",
+		invitation.Email,
+		locale,
+		struct {
+			ServiceURL string
+			ResetToken string
+		}{serviceURLFromContext(context), string(invitationToken)},
+	)
+	return
+}
@@ -0,0 +1,70 @@
+package service_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInvitationIsAcceptedWithTheNewPassword(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	administrator := createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	administratorToken := loginTestAccount(test, identityService, administrator.Email)
+
+	response := serveTestRequest(identityService, http.MethodPost, "/account", administratorToken, map[string]interface{}{"email": "invitee@example.com", "roles": []string{"user"}})
+	assert.Equal(test, http.StatusCreated, response.Code)
+
+	firstToken := latestTestEmailToken(test, identityService, "invitee@example.com")
+
+	response = serveTestRequest(identityService, http.MethodGet, "/invitation?status=pending", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	var invitations []entity.Invitation
+	err := json.Unmarshal(response.Body.Bytes(), &invitations)
+	assert.NoError(test, err)
+	if !assert.Equal(test, 1, len(invitations)) {
+		return
+	}
+	assert.Equal(test, administrator.ID, invitations[0].InvitedBy)
+
+	// Only the link of the latest invitation accepts it, the links only differ if they expire at different seconds
+	time.Sleep(time.Second)
+	response = serveTestRequest(identityService, http.MethodPost, "/invitation/"+invitations[0].ID+"/resend", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	token := latestTestEmailToken(test, identityService, "invitee@example.com")
+	assert.NotEqual(test, firstToken, token)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/account/reset-token/password", firstToken, map[string]string{"password": testPassword})
+	assert.Equal(test, http.StatusUnauthorized, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/account/reset-token/password", token, map[string]string{"password": "short"})
+	assert.Equal(test, http.StatusBadRequest, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/account/reset-token/password", token, map[string]string{"password": testPassword})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	invitation, err := entity.LoadInvitationFromID(identityService.DatabaseConnection, invitations[0].ID)
+	assert.NoError(test, err)
+	assert.Equal(test, entity.InvitationAccepted, invitation.Status)
+	assert.NotNil(test, invitation.AcceptedAt)
+
+	account, err := entity.LoadAccountFromEmail(identityService.DatabaseConnection, "invitee@example.com")
+	assert.NoError(test, err)
+	assert.True(test, account.EmailVerified)
+
+	loginTestAccount(test, identityService, "invitee@example.com")
+
+	// The link stops working once the invitation has been accepted
+	response = serveTestRequest(identityService, http.MethodPost, "/account/reset-token/password", token, map[string]string{"password": testPassword + "-again"})
+	assert.Equal(test, http.StatusUnauthorized, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/invitation/"+invitations[0].ID+"/resend", administratorToken, nil)
+	assert.Equal(test, http.StatusConflict, response.Code)
+}
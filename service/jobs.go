@@ -0,0 +1,132 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+)
+
+func (service *Service) runPeriodically(interval time.Duration, job func()) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				job()
+			case <-service.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (service *Service) purgeDeletedAccounts() {
+	purged, err := entity.PurgeDeletedAccounts(service.DatabaseConnection, time.Now().Add(-service.AccountRestorePeriod))
+	if err != nil {
+		service.Log.Error(err)
+		return
+	}
+
+	if purged > 0 {
+		service.Log.Info(fmt.Sprintf("Permanently removed %d deleted accounts that was past the restore period", purged))
+	}
+}
+
+func (service *Service) sendExpiryWarnings() {
+	accounts, err := entity.LoadAccountsPendingExpiryWarning(service.DatabaseConnection, time.Now().Add(service.ExpiryWarningPeriod))
+	if err != nil {
+		service.Log.Error(err)
+		return
+	}
+
+	for _, account := range accounts {
+		realm, exists := service.getRealm(account.RealmID)
+		if !exists {
+			continue
+		}
+
+		// The warning is only marked as sent if it could be queued
+		err = service.inTransaction(func(transaction *gorm.DB) error {
+			claimed, claimErr := account.MarkExpiryWarningSent(transaction)
+			if claimErr != nil || !claimed {
+				return claimErr
+			}
+
+			return service.queueEmail(
+				transaction,
+				realm,
+				"account-expiring",
+				account.Email,
+				account.Locale,
+				struct {
+					Email     string
+					ExpiresAt time.Time
+				}{account.Email, *account.ExpiresAt},
+			)
+		})
+		if err != nil {
+			service.Log.Error(err)
+		}
+	}
+}
+
+func (service *Service) purgeExpiredDeviceAuthorizations() {
+	_, err := entity.PurgeExpiredDeviceAuthorizations(service.DatabaseConnection, time.Now())
+	if err != nil {
+		service.Log.Error(err)
+	}
+}
+
+func (service *Service) deliverQueuedEmails() {
+	emails, err := entity.LoadDueOutboxEmails(service.DatabaseConnection, time.Now(), outboxBatchSize)
+	if err != nil {
+		service.Log.Error(err)
+		return
+	}
+
+	for _, email := range emails {
+		claimed, err := email.Claim(service.DatabaseConnection, time.Now().Add(emailClaimTimeout))
+		if err != nil {
+			service.Log.Error(err)
+			continue
+		}
+
+		if !claimed {
+			continue
+		}
+
+		sendErr := service.EmailSender.Send(Email{To: email.Recipient, Subject: email.Subject, Body: email.Body, Text: email.TextBody})
+		if sendErr == nil {
+			err = email.MarkSent(service.DatabaseConnection)
+			if err != nil {
+				service.Log.Error(err)
+			}
+			continue
+		}
+
+		var nextAttemptAt *time.Time
+		if email.Attempts < service.EmailMaxAttempts {
+			next := time.Now().Add(service.emailRetryDelay(email.Attempts))
+			nextAttemptAt = &next
+		} else {
+			service.Log.Error(fmt.Sprintf("Gave up on delivering email %s after %d attempts", email.ID, email.Attempts))
+		}
+
+		err = email.MarkAttemptFailed(service.DatabaseConnection, sendErr.Error(), nextAttemptAt)
+		if err != nil {
+			service.Log.Error(err)
+		}
+	}
+}
+
+func (service *Service) purgeSentEmails() {
+	_, err := entity.PurgeSentOutboxEmails(service.DatabaseConnection, time.Now().Add(-sentEmailRetention))
+	if err != nil {
+		service.Log.Error(err)
+	}
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// LocalizedEmailTemplate is an email template in one locale, the subject and the text body are text templates and the HTML body is an HTML template, one of the bodies may be missing. The sources are the contents of the files that the templates were parsed from.
+type LocalizedEmailTemplate struct {
+	Name          string
+	Locale        string
+	Subject       *texttemplate.Template
+	HTML          *htmltemplate.Template
+	Text          *texttemplate.Template
+	SubjectSource string
+	HTMLSource    string
+	TextSource    string
+}
+
+// LocalizedEmailTemplates holds email templates in several locales, a template is looked up in the locale of the account, then in its language and last in the default locale
+type LocalizedEmailTemplates struct {
+	DefaultLocale string
+	byLocale      map[string]map[string]LocalizedEmailTemplate
+}
+
+// LoadLocalizedEmailTemplates will read the templates from a directory with one subdirectory per locale (e.g. en, sv or sv-fi) where each template is made of the files <name>.subject, <name>.html and <name>.txt, the subject and at least one of the bodies are required
+func LoadLocalizedEmailTemplates(directory string, defaultLocale string) (templates *LocalizedEmailTemplates, err error) {
+	templates = &LocalizedEmailTemplates{DefaultLocale: normalizeLocale(defaultLocale), byLocale: map[string]map[string]LocalizedEmailTemplate{}}
+
+	localeDirectories, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return
+	}
+
+	for _, localeDirectory := range localeDirectories {
+		if !localeDirectory.IsDir() {
+			continue
+		}
+
+		locale := normalizeLocale(localeDirectory.Name())
+		templates.byLocale[locale] = map[string]LocalizedEmailTemplate{}
+
+		var subjectFiles []string
+		subjectFiles, err = filepath.Glob(filepath.Join(directory, localeDirectory.Name(), "*.subject"))
+		if err != nil {
+			return
+		}
+
+		for _, subjectFile := range subjectFiles {
+			name := strings.TrimSuffix(filepath.Base(subjectFile), ".subject")
+
+			var template LocalizedEmailTemplate
+			template, err = loadLocalizedEmailTemplate(strings.TrimSuffix(subjectFile, ".subject"), name, locale)
+			if err != nil {
+				return
+			}
+
+			templates.byLocale[locale][name] = template
+		}
+	}
+
+	return
+}
+
+// loadLocalizedEmailTemplate parses the files that starts with the path
+func loadLocalizedEmailTemplate(path string, name string, locale string) (template LocalizedEmailTemplate, err error) {
+	template = LocalizedEmailTemplate{Name: name, Locale: locale}
+
+	subject, err := ioutil.ReadFile(path + ".subject")
+	if err != nil {
+		return
+	}
+
+	template.SubjectSource = strings.TrimSpace(string(subject))
+	template.Subject, err = texttemplate.New(name + ".subject").Parse(template.SubjectSource)
+	if err != nil {
+		return
+	}
+
+	html, err := ioutil.ReadFile(path + ".html")
+	if err == nil {
+		template.HTMLSource = string(html)
+		template.HTML, err = htmltemplate.New(name + ".html").Parse(template.HTMLSource)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+
+	text, err := ioutil.ReadFile(path + ".txt")
+	if err == nil {
+		template.TextSource = string(text)
+		template.Text, err = texttemplate.New(name + ".txt").Parse(template.TextSource)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	err = nil
+
+	if template.HTML == nil && template.Text == nil {
+		err = &os.PathError{Op: "open", Path: path + ".html or " + path + ".txt", Err: os.ErrNotExist}
+	}
+
+	return
+}
+
+// normalizeLocale lower cases the locale and uses - as separator so that sv_FI, sv-FI and sv-fi are the same locale
+func normalizeLocale(locale string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(locale), "_", "-", -1))
+}
+
+// localeFallbacks returns the locales to look for a template in, e.g. sv-fi, sv and then the default locale
+func localeFallbacks(locale string, defaultLocale string) (locales []string) {
+	locale = normalizeLocale(locale)
+	for locale != "" {
+		locales = append(locales, locale)
+
+		separator := strings.LastIndex(locale, "-")
+		if separator < 0 {
+			break
+		}
+		locale = locale[:separator]
+	}
+
+	if defaultLocale != "" {
+		locales = append(locales, defaultLocale)
+	}
+
+	return
+}
+
+// Render renders the template with the name in the best matching locale, found is false if there is no such template in any of the fallback locales
+func (templates *LocalizedEmailTemplates) Render(name string, locale string, data interface{}) (email Email, found bool, err error) {
+	for _, candidate := range localeFallbacks(locale, templates.DefaultLocale) {
+		template, exists := templates.template(name, candidate)
+		if !exists {
+			continue
+		}
+
+		found = true
+		email, err = template.Render(data)
+		return
+	}
+
+	return
+}
+
+// template returns the template with the name in exactly the locale, without trying any other locale
+func (templates *LocalizedEmailTemplates) template(name string, locale string) (template LocalizedEmailTemplate, exists bool) {
+	template, exists = templates.byLocale[locale][name]
+	return
+}
+
+// Render renders the subject and the bodies of the template with the data, the recipient is left empty
+func (template LocalizedEmailTemplate) Render(data interface{}) (email Email, err error) {
+	buffer := &bytes.Buffer{}
+	err = template.Subject.Execute(buffer, data)
+	if err != nil {
+		return
+	}
+	email.Subject = strings.TrimSpace(buffer.String())
+
+	if template.HTML != nil {
+		buffer.Reset()
+		err = template.HTML.Execute(buffer, data)
+		if err != nil {
+			return
+		}
+		email.Body = buffer.String()
+	}
+
+	if template.Text != nil {
+		buffer.Reset()
+		err = template.Text.Execute(buffer, data)
+		if err != nil {
+			return
+		}
+		email.Text = buffer.String()
+	}
+
+	return
+}
@@ -0,0 +1,78 @@
+package service_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mojlighetsministeriet/identity-provider/service"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTemplateFile(test *testing.T, directory string, locale string, file string, content string) {
+	err := os.MkdirAll(filepath.Join(directory, locale), 0700)
+	assert.NoError(test, err)
+
+	err = ioutil.WriteFile(filepath.Join(directory, locale, file), []byte(content), 0600)
+	assert.NoError(test, err)
+}
+
+func TestLocalizedEmailTemplates(test *testing.T) {
+	directory := "/tmp/identity-provider-test-" + uuid.Must(uuid.NewV4()).String()
+	defer os.RemoveAll(directory)
+
+	writeTemplateFile(test, directory, "en", "reset-password.subject", "Password reset\n")
+	writeTemplateFile(test, directory, "en", "reset-password.html", "<a href=\"{{.ServiceURL}}/reset-password?token={{.ResetToken}}\">Reset</a>")
+	writeTemplateFile(test, directory, "en", "reset-password.txt", "Reset at {{.ServiceURL}}/reset-password?token={{.ResetToken}}")
+	writeTemplateFile(test, directory, "sv", "reset-password.subject", "Återställ lösenord")
+	writeTemplateFile(test, directory, "sv", "reset-password.txt", "Återställ på {{.ServiceURL}}/reset-password?token={{.ResetToken}}")
+
+	templates, err := service.LoadLocalizedEmailTemplates(directory, "en")
+	assert.NoError(test, err)
+
+	data := struct {
+		ServiceURL string
+		ResetToken string
+	}{"https://example.com", "a&b"}
+
+	email, found, err := templates.Render("reset-password", "sv_FI", data)
+	assert.NoError(test, err)
+	assert.True(test, found)
+	assert.Equal(test, "Återställ lösenord", email.Subject)
+	assert.Equal(test, "", email.Body)
+	assert.Equal(test, "Återställ på https://example.com/reset-password?token=a&b", email.Text)
+
+	email, found, err = templates.Render("reset-password", "de", data)
+	assert.NoError(test, err)
+	assert.True(test, found)
+	assert.Equal(test, "Password reset", email.Subject)
+	assert.Equal(test, "<a href=\"https://example.com/reset-password?token=a%26b\">Reset</a>", email.Body)
+	assert.Equal(test, "Reset at https://example.com/reset-password?token=a&b", email.Text)
+
+	_, found, err = templates.Render("login-link", "en", data)
+	assert.NoError(test, err)
+	assert.False(test, found)
+}
+
+func TestLocalizedEmailTemplatesRequireABody(test *testing.T) {
+	directory := "/tmp/identity-provider-test-" + uuid.Must(uuid.NewV4()).String()
+	defer os.RemoveAll(directory)
+
+	writeTemplateFile(test, directory, "en", "login-link.subject", "Your login link")
+
+	_, err := service.LoadLocalizedEmailTemplates(directory, "en")
+	assert.Error(test, err)
+}
+
+func TestLocalizedEmailTemplatesWithInvalidTemplate(test *testing.T) {
+	directory := "/tmp/identity-provider-test-" + uuid.Must(uuid.NewV4()).String()
+	defer os.RemoveAll(directory)
+
+	writeTemplateFile(test, directory, "en", "login-link.subject", "Your login link")
+	writeTemplateFile(test, directory, "en", "login-link.html", "{{.LoginToken")
+
+	_, err := service.LoadLocalizedEmailTemplates(directory, "en")
+	assert.Error(test, err)
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+func (service *Service) organizationResource() {
+	organizationGroup := service.Router.Group("/organization")
+	canRead := service.requirePermission("organization:read")
+	canWrite := service.requirePermission("organization:write")
+
+	organizationGroup.GET("", func(context echo.Context) error {
+		organizations, err := entity.LoadOrganizations(service.realmDatabase(context))
+		if err == nil {
+			return context.JSON(http.StatusOK, organizations)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canRead)
+
+	organizationGroup.POST("", func(context echo.Context) error {
+		organization := entity.Organization{}
+		err := context.Bind(&organization)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		organization.ID = ""
+		organization.RealmID = realmFromContext(context).Realm.Name
+		organization.BeforeSave()
+
+		return service.saveOrganization(context, organization, true)
+	}, canWrite)
+
+	organizationGroup.GET("/:id", func(context echo.Context) error {
+		organization, err := entity.LoadOrganizationFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		return context.JSON(http.StatusOK, organization)
+	}, canRead)
+
+	organizationGroup.PUT("/:id", func(context echo.Context) error {
+		organization, err := entity.LoadOrganizationFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		changes := entity.Organization{}
+		err = context.Bind(&changes)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		organization.Name = changes.Name
+		organization.Description = changes.Description
+
+		return service.saveOrganization(context, organization, false)
+	}, canWrite)
+
+	organizationGroup.DELETE("/:id", func(context echo.Context) error {
+		organization, err := entity.LoadOrganizationFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		err = organization.Delete(service.DatabaseConnection)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Deleted\"}"))
+	}, canWrite)
+
+	organizationGroup.GET("/:id/members", func(context echo.Context) error {
+		organization, err := entity.LoadOrganizationFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		members, err := entity.LoadOrganizationMembers(service.DatabaseConnection, organization.ID)
+		if err == nil {
+			return context.JSON(http.StatusOK, members)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canRead)
+
+	organizationGroup.PUT("/:id/members/:accountId", func(context echo.Context) error {
+		type memberBody struct {
+			Role string `json:"role" validate:"required,max=50"`
+		}
+
+		parameters := memberBody{}
+		context.Bind(&parameters)
+
+		validate := validator.New()
+		err := validate.Struct(parameters)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		organization, err := entity.LoadOrganizationFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		account, err := entity.LoadAccountFromID(service.realmDatabase(context), context.Param("accountId"))
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The account does not exist\"}"))
+		}
+
+		err = organization.SetMember(service.DatabaseConnection, account.ID, parameters.Role)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Member saved\"}"))
+	}, canWrite)
+
+	organizationGroup.DELETE("/:id/members/:accountId", func(context echo.Context) error {
+		organization, err := entity.LoadOrganizationFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		err = organization.RemoveMember(service.DatabaseConnection, context.Param("accountId"))
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Member removed\"}"))
+	}, canWrite)
+}
+
+func (service *Service) saveOrganization(context echo.Context, organization entity.Organization, isNew bool) error {
+	validate := validator.New()
+	err := validate.Struct(organization)
+	if err != nil {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+	}
+
+	if isNew {
+		err = service.DatabaseConnection.Create(&organization).Error
+	} else {
+		err = service.DatabaseConnection.Save(&organization).Error
+	}
+	if err != nil {
+		// TODO: handle for non-MySQL databases as well
+		if strings.HasPrefix(err.Error(), "Error 1062") {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The name was already taken\"}"))
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	if isNew {
+		return context.JSON(http.StatusCreated, organization)
+	}
+
+	return context.JSON(http.StatusOK, organization)
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+)
+
+// emailClaimTimeout is how long a replica has to deliver an email that it has claimed before another replica may attempt it
+const emailClaimTimeout = 5 * time.Minute
+
+// maximumEmailRetryDelay caps the exponential backoff between delivery attempts
+const maximumEmailRetryDelay = time.Hour
+
+// sentEmailRetention is how long sent emails are kept in the outbox so that administrators can see that they were delivered
+const sentEmailRetention = 7 * 24 * time.Hour
+
+// outboxBatchSize is the most emails that are attempted each time the outbox is processed
+const outboxBatchSize = 50
+
+func (service *Service) outboxResource() {
+	outboxGroup := service.Router.Group("/email-outbox")
+	canRead := service.requirePermission("email:read")
+	canWrite := service.requirePermission("email:write")
+
+	outboxGroup.GET("", func(context echo.Context) error {
+		status := context.QueryParam("status")
+		if !entity.IsValidOutboxStatus(status) {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The status must be one of pending, sent or failed\"}"))
+		}
+
+		emails, err := entity.LoadOutboxEmails(service.realmDatabase(context), status)
+		if err == nil {
+			if emails == nil {
+				emails = []entity.OutboxEmail{}
+			}
+
+			return context.JSON(http.StatusOK, emails)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canRead)
+
+	outboxGroup.POST("/:id/retry", func(context echo.Context) error {
+		email, err := entity.LoadOutboxEmailFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		retried, err := email.Retry(service.DatabaseConnection)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		if !retried {
+			return context.JSONBlob(http.StatusConflict, []byte("{\"message\":\"Only failed emails can be retried\"}"))
+		}
+
+		return context.JSON(http.StatusOK, email)
+	}, canWrite)
+}
+
+// emailRetryDelay returns how long to wait after the attempt before the next one, the delay doubles with every attempt
+func (service *Service) emailRetryDelay(attempts int) time.Duration {
+	delay := service.EmailRetryDelay
+	for attempt := 1; attempt < attempts && delay < maximumEmailRetryDelay; attempt++ {
+		delay *= 2
+	}
+
+	if delay > maximumEmailRetryDelay {
+		delay = maximumEmailRetryDelay
+	}
+
+	return delay
+}
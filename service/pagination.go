@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+)
+
+const defaultPerPage = 50
+const maximumPerPage = 500
+
+type pagination struct {
+	Page    int
+	PerPage int
+}
+
+func (page pagination) Offset() int {
+	return (page.Page - 1) * page.PerPage
+}
+
+func getPaginationFromContext(context echo.Context) (page pagination, err error) {
+	page = pagination{Page: 1, PerPage: defaultPerPage}
+
+	if context.QueryParam("page") != "" {
+		page.Page, err = strconv.Atoi(context.QueryParam("page"))
+		if err != nil || page.Page < 1 {
+			err = errors.New("page must be a positive integer")
+			return
+		}
+	}
+
+	if context.QueryParam("perPage") != "" {
+		page.PerPage, err = strconv.Atoi(context.QueryParam("perPage"))
+		if err != nil || page.PerPage < 1 || page.PerPage > maximumPerPage {
+			err = fmt.Errorf("perPage must be an integer between 1 and %d", maximumPerPage)
+			return
+		}
+	}
+
+	return
+}
+
+// setPaginationHeaders will add X-Total-Count and a Link header (RFC 5988) with first, prev, next and last pages to the response
+func setPaginationHeaders(context echo.Context, page pagination, total int) {
+	context.Response().Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	lastPage := (total + page.PerPage - 1) / page.PerPage
+	if lastPage < 1 {
+		lastPage = 1
+	}
+
+	linkTo := func(number int, relation string) string {
+		query := url.Values{}
+		for key, values := range context.QueryParams() {
+			query[key] = values
+		}
+		query.Set("page", strconv.Itoa(number))
+		query.Set("perPage", strconv.Itoa(page.PerPage))
+
+		// The realm path prefix has been removed from the path before routing but the links have to stay in the same realm
+		return fmt.Sprintf("<%s%s?%s>; rel=\"%s\"", realmPathPrefix(context), context.Request().URL.Path, query.Encode(), relation)
+	}
+
+	links := []string{linkTo(1, "first")}
+	if page.Page > 1 {
+		links = append(links, linkTo(page.Page-1, "prev"))
+	}
+	if page.Page < lastPage {
+		links = append(links, linkTo(page.Page+1, "next"))
+	}
+	links = append(links, linkTo(lastPage, "last"))
+
+	context.Response().Header().Set("Link", strings.Join(links, ", "))
+}
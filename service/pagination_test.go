@@ -0,0 +1,46 @@
+package service_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaginationLinksStayInTheRealm(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	administratorToken := loginTestAccount(test, identityService, "administrator@example.com")
+
+	response := serveTestRequest(identityService, http.MethodPost, "/realm", administratorToken, map[string]string{"name": "acme"})
+	assert.Equal(test, http.StatusCreated, response.Code)
+
+	for _, email := range []string{"administrator@acme.example.com", "first@acme.example.com", "second@acme.example.com"} {
+		createTestAccount(test, identityService, entity.Account{RealmID: "acme", Email: email, Roles: []string{"user", "administrator"}})
+	}
+
+	response = serveTestRequest(identityService, http.MethodPost, "/realms/acme/token", "", map[string]string{"email": "administrator@acme.example.com", "password": testPassword})
+	assert.Equal(test, http.StatusCreated, response.Code)
+	acmeToken := decodeTestTokenResponse(test, response.Body.Bytes())
+
+	// The realm also has the administrator account that was created with it
+	response = serveTestRequest(identityService, http.MethodGet, "/realms/acme/account?perPage=2&page=2&sort=email", acmeToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+	assert.Equal(test, "4", response.Header().Get("X-Total-Count"))
+	assert.Equal(
+		test,
+		"</realms/acme/account?page=1&perPage=2&sort=email>; rel=\"first\", </realms/acme/account?page=1&perPage=2&sort=email>; rel=\"prev\", </realms/acme/account?page=2&perPage=2&sort=email>; rel=\"last\"",
+		response.Header().Get("Link"),
+	)
+
+	response = serveTestRequest(identityService, http.MethodGet, "/account?perPage=1", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+	assert.Equal(
+		test,
+		"</account?page=1&perPage=1>; rel=\"first\", </account?page=2&perPage=1>; rel=\"next\", </account?page=2&perPage=1>; rel=\"last\"",
+		response.Header().Get("Link"),
+	)
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/mojlighetsministeriet/utils/jwt"
+)
+
+// rejectPassword responds with the rules of the password policy that the password does not satisfy, rejected is false if it satisfies all of them and then nothing has been written to the response
+func (service *Service) rejectPassword(context echo.Context, password string, email string) (rejected bool, err error) {
+	violations, checkErr := service.PasswordPolicy.Check(password, email)
+	if checkErr != nil {
+		service.Log.Error("Unable to look up the password in the breached password list, it was only checked against the other rules")
+		service.Log.Error(checkErr)
+	}
+
+	if len(violations) == 0 {
+		return
+	}
+
+	rejected = true
+	err = context.JSON(http.StatusBadRequest, struct {
+		Message    string                     `json:"message"`
+		Violations []entity.PasswordViolation `json:"violations"`
+	}{Message: "The password does not satisfy the password policy", Violations: violations})
+	return
+}
+
+// rejectReusedPassword responds like rejectPassword if the password is one of the latest passwords of the account according to the history size of the password policy
+func (service *Service) rejectReusedPassword(context echo.Context, account *entity.Account, password string) (rejected bool, err error) {
+	reused, err := account.IsPasswordReused(service.DatabaseConnection, password, service.PasswordPolicy.History)
+	if err != nil {
+		service.Log.Error(err)
+		rejected = true
+		err = context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		return
+	}
+
+	if !reused {
+		return
+	}
+
+	rejected = true
+	err = context.JSON(http.StatusBadRequest, struct {
+		Message    string                     `json:"message"`
+		Violations []entity.PasswordViolation `json:"violations"`
+	}{
+		Message: "The password does not satisfy the password policy",
+		Violations: []entity.PasswordViolation{{
+			Rule:    "reused",
+			Message: fmt.Sprintf("The password must not be one of the latest %d passwords of the account", service.PasswordPolicy.History),
+			Limit:   service.PasswordPolicy.History,
+		}},
+	})
+	return
+}
+
+// tokenUsePasswordChange is the value of the token_use claim of the tokens that are issued instead of access tokens to accounts that have to change their password, they grant no permissions and can only be used to change the password
+const tokenUsePasswordChange = "password-change"
+
+// respondWithPasswordChangeToken responds through respond with a short-lived token that can only be used to change the password of the account
+func (service *Service) respondWithPasswordChangeToken(context echo.Context, account entity.Account, respond tokenResponder) error {
+	account.Roles = []string{}
+
+	token, err := service.signToken(realmFromContext(context), &account, tokenClaims{
+		"exp":         time.Now().Add(service.PasswordChangeTokenLifetime).Unix(),
+		"permissions": []string{},
+		"token_use":   tokenUsePasswordChange,
+	})
+	if err != nil {
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	return respond(context, token, true)
+}
+
+// accountIDForPasswordChange returns the id of the account if the request carries a token that the account got for itself or a password change token
+func (service *Service) accountIDForPasswordChange(context echo.Context) (accountID string, authorized bool) {
+	claims, err := jwt.GetClaimsFromContextIfValid(&realmFromContext(context).PrivateKey.PublicKey, context)
+	if err == nil && claims.Get("act") == nil && claims.Get("token_use") == tokenUsePasswordChange {
+		accountID, _ = claims.Get("sub").(string)
+		authorized = accountID != ""
+		return
+	}
+
+	return service.accountIDForConsent(context)
+}
+
+func (service *Service) passwordResource() {
+	service.Router.POST("/account/password", func(context echo.Context) error {
+		type changePasswordBody struct {
+			CurrentPassword string `json:"currentPassword"`
+			Password        string `json:"password"`
+		}
+
+		accountID, authorized := service.accountIDForPasswordChange(context)
+		if !authorized {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		parameters := changePasswordBody{}
+		err := context.Bind(&parameters)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		account, err := entity.LoadAccountFromID(service.realmDatabase(context), accountID)
+		if err != nil || !account.CanAuthenticate() {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		if account.CompareHashedPasswordAgainst(parameters.CurrentPassword) != nil {
+			return context.JSONBlob(http.StatusForbidden, []byte("{\"message\":\"The current password is wrong\"}"))
+		}
+
+		if rejected, err := service.rejectPassword(context, parameters.Password, account.Email); rejected {
+			return err
+		}
+
+		if rejected, err := service.rejectReusedPassword(context, &account, parameters.Password); rejected {
+			return err
+		}
+
+		previousHash := account.Password
+		err = account.SetPassword(parameters.Password)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		err = service.inTransaction(func(transaction *gorm.DB) error {
+			err := transaction.Model(&account).UpdateColumns(map[string]interface{}{
+				"password":             account.Password,
+				"password_changed_at":  account.PasswordChangedAt,
+				"must_change_password": false,
+			}).Error
+			if err != nil {
+				return err
+			}
+
+			return entity.RememberPreviousPassword(transaction, account.ID, previousHash, service.PasswordPolicy.History)
+		})
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Password was changed\"}"))
+	})
+}
@@ -0,0 +1,56 @@
+package service_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviousPasswordCannotBeReused(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	identityService.PasswordPolicy.History = 3
+
+	administrator := createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	user := createTestAccount(test, identityService, entity.Account{Email: "user@example.com", Roles: []string{"user"}})
+	administratorToken := loginTestAccount(test, identityService, administrator.Email)
+	userToken := loginTestAccount(test, identityService, user.Email)
+
+	response := serveTestRequest(identityService, http.MethodPost, "/account/password", userToken, map[string]string{"currentPassword": testPassword, "password": "second-horse-battery-staple"})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPut, "/account/"+user.ID, administratorToken, map[string]string{"password": "third-horse-battery-staple"})
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	// Both the password that was changed by the account and the one replaced by the administrator are remembered
+	for _, password := range []string{testPassword, "second-horse-battery-staple", "third-horse-battery-staple"} {
+		response = serveTestRequest(identityService, http.MethodPost, "/account/password", userToken, map[string]string{"currentPassword": "third-horse-battery-staple", "password": password})
+		assert.Equal(test, http.StatusBadRequest, response.Code, password)
+	}
+}
+
+func TestPasswordIsNotChangedIfThePreviousOneCannotBeRemembered(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	identityService.PasswordPolicy.History = 3
+
+	administrator := createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	user := createTestAccount(test, identityService, entity.Account{Email: "user@example.com", Roles: []string{"user"}})
+	administratorToken := loginTestAccount(test, identityService, administrator.Email)
+	userToken := loginTestAccount(test, identityService, user.Email)
+
+	err := identityService.DatabaseConnection.Exec("CREATE TRIGGER forget_passwords BEFORE INSERT ON password_history_entries BEGIN SELECT RAISE(ABORT, 'The password history is unavailable'); END").Error
+	assert.NoError(test, err)
+
+	response := serveTestRequest(identityService, http.MethodPost, "/account/password", userToken, map[string]string{"currentPassword": testPassword, "password": "second-horse-battery-staple"})
+	assert.Equal(test, http.StatusInternalServerError, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPut, "/account/"+user.ID, administratorToken, map[string]string{"password": "third-horse-battery-staple"})
+	assert.Equal(test, http.StatusInternalServerError, response.Code)
+
+	loginTestAccount(test, identityService, user.Email)
+}
@@ -10,7 +10,7 @@ import (
 
 func (service *Service) publicKeyResource() {
 	service.Router.GET("/public-key", func(context echo.Context) error {
-		body, err := x509.MarshalPKIXPublicKey(&service.PrivateKey.PublicKey)
+		body, err := x509.MarshalPKIXPublicKey(&realmFromContext(context).PrivateKey.PublicKey)
 		if err != nil {
 			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
 		}
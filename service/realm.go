@@ -0,0 +1,430 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/mojlighetsministeriet/utils"
+	"github.com/mojlighetsministeriet/utils/emailtemplates"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+const realmCacheLifetime = 30 * time.Second
+
+// loadedRealm is a realm together with its parsed private key and its own email templates by locale and name, the locale is empty for the templates that are used in every locale
+type loadedRealm struct {
+	Realm          entity.Realm
+	PrivateKey     *rsa.PrivateKey
+	EmailTemplates map[string]map[string]entity.RealmEmailTemplate
+}
+
+type realmCache struct {
+	sync.RWMutex
+	byName   map[string]*loadedRealm
+	byHost   map[string]*loadedRealm
+	loadedAt time.Time
+}
+
+// loadRealms will read all realms from the persistence, other replicas may create or change realms so this is also done whenever the cache is older than realmCacheLifetime
+func (service *Service) loadRealms() (err error) {
+	realms, err := entity.LoadRealms(service.DatabaseConnection)
+	if err != nil {
+		return
+	}
+
+	byName := map[string]*loadedRealm{}
+	byHost := map[string]*loadedRealm{}
+
+	for _, realm := range realms {
+		loaded := &loadedRealm{Realm: realm, EmailTemplates: realmEmailTemplatesByLocale(realm.EmailTemplates)}
+
+		if realm.Name == entity.DefaultRealm {
+			loaded.PrivateKey = service.PrivateKey
+		} else {
+			loaded.PrivateKey, err = pemStringToPrivateKey(realm.PrivateKey)
+			if err != nil {
+				service.Log.Error("Unable to read the private key of realm " + realm.Name)
+				service.Log.Error(err)
+				continue
+			}
+		}
+
+		byName[realm.Name] = loaded
+		if realm.Host != "" {
+			byHost[strings.ToLower(realm.Host)] = loaded
+		}
+	}
+
+	service.realms.Lock()
+	service.realms.byName = byName
+	service.realms.byHost = byHost
+	service.realms.loadedAt = time.Now()
+	service.realms.Unlock()
+
+	return
+}
+
+func (service *Service) refreshRealmsIfStale() {
+	service.realms.RLock()
+	stale := time.Since(service.realms.loadedAt) > realmCacheLifetime
+	service.realms.RUnlock()
+
+	if stale {
+		err := service.loadRealms()
+		if err != nil {
+			service.Log.Error(err)
+		}
+	}
+}
+
+func (service *Service) getRealm(name string) (realm *loadedRealm, exists bool) {
+	service.refreshRealmsIfStale()
+
+	service.realms.RLock()
+	realm, exists = service.realms.byName[name]
+	service.realms.RUnlock()
+
+	return
+}
+
+func (service *Service) getRealmFromHost(host string) (realm *loadedRealm, exists bool) {
+	service.refreshRealmsIfStale()
+
+	hostname, _, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname = host
+	}
+
+	service.realms.RLock()
+	realm, exists = service.realms.byHost[strings.ToLower(hostname)]
+	service.realms.RUnlock()
+
+	return
+}
+
+// realmMiddleware decides which realm a request belongs to, either by the path prefix /realms/<name>/ (which is removed before routing) or by the host of the request and otherwise the default realm
+func (service *Service) realmMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(context echo.Context) error {
+		request := context.Request()
+
+		var realm *loadedRealm
+		var exists bool
+
+		if strings.HasPrefix(request.URL.Path, "/realms/") {
+			parts := strings.SplitN(strings.TrimPrefix(request.URL.Path, "/realms/"), "/", 2)
+			realm, exists = service.getRealm(parts[0])
+			if !exists {
+				return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"The realm does not exist\"}"))
+			}
+
+			request.URL.Path = "/"
+			if len(parts) == 2 {
+				request.URL.Path += parts[1]
+			}
+			request.URL.RawPath = ""
+
+			context.Set("realmPathPrefix", "/realms/"+realm.Realm.Name)
+		} else {
+			realm, exists = service.getRealmFromHost(request.Host)
+			if !exists {
+				realm, exists = service.getRealm(entity.DefaultRealm)
+			}
+			if !exists {
+				return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+			}
+		}
+
+		context.Set("realm", realm)
+
+		return next(context)
+	}
+}
+
+func realmFromContext(context echo.Context) *loadedRealm {
+	return context.Get("realm").(*loadedRealm)
+}
+
+// realmPathPrefix returns the /realms/<name> prefix that realmMiddleware removed from the path of the request, or an empty string if the realm was not given in the path
+func realmPathPrefix(context echo.Context) string {
+	prefix, _ := context.Get("realmPathPrefix").(string)
+	return prefix
+}
+
+// serviceURLFromContext returns the URL that the client used to reach the service, including the realm path prefix if there was one
+func serviceURLFromContext(context echo.Context) string {
+	return utils.GetOriginalSystemURLFromContext(context) + realmPathPrefix(context)
+}
+
+// realmDatabase returns a database connection narrowed to the realm of the request, use it when reading accounts, roles and groups
+func (service *Service) realmDatabase(context echo.Context) *gorm.DB {
+	return entity.InRealm(service.DatabaseConnection, realmFromContext(context).Realm.Name)
+}
+
+// queueEmail renders the email template in the locale of the recipient and writes it to the outbox with the database connection, pass the transaction of the change that the email is about so that the email is queued if and only if the change is committed
+func (service *Service) queueEmail(databaseConnection *gorm.DB, realm *loadedRealm, templateName string, to string, locale string, data interface{}) error {
+	email, err := service.renderEmail(realm, templateName, to, locale, data)
+	if err != nil {
+		return err
+	}
+
+	return databaseConnection.Create(&entity.OutboxEmail{
+		RealmID:   realm.Realm.Name,
+		Template:  templateName,
+		Recipient: email.To,
+		Subject:   email.Subject,
+		Body:      email.Body,
+		TextBody:  email.Text,
+	}).Error
+}
+
+// renderEmail renders the template that resolveEmailTemplate finds for the locale
+func (service *Service) renderEmail(realm *loadedRealm, templateName string, to string, locale string, data interface{}) (email Email, err error) {
+	template, exists := service.resolveEmailTemplate(realm.EmailTemplates, templateName, locale)
+
+	if exists && template.Source == emailTemplateFromRealm {
+		return renderEditedEmailTemplate(templateName, template.Subject, template.Body, template.Text, to, data)
+	}
+
+	if exists && template.Source == emailTemplateFromDirectory {
+		localizedTemplate, _ := service.LocalizedEmailTemplates.template(templateName, template.SourceLocale)
+		email, err = localizedTemplate.Render(data)
+		email.To = to
+		return
+	}
+
+	rendered, err := service.EmailTemplates.Render(templateName, to, nil, data)
+	if err == nil {
+		email = Email{To: rendered.To, Subject: rendered.Subject, Body: rendered.Body}
+	}
+
+	return
+}
+
+// renderEditedEmailTemplate renders a template that has been edited through the API, the email has no plain text version if the text is empty
+func renderEditedEmailTemplate(name string, subject string, body string, text string, to string, data interface{}) (email Email, err error) {
+	templates := emailtemplates.Templates{}
+	templates.Add(emailtemplates.Template{Name: name, Subject: subject, Body: body})
+
+	rendered, err := templates.Render(name, to, nil, data)
+	if err != nil {
+		return
+	}
+	email = Email{To: rendered.To, Subject: rendered.Subject, Body: rendered.Body}
+
+	if text != "" {
+		var textTemplate *texttemplate.Template
+		textTemplate, err = texttemplate.New(name + ".text").Parse(text)
+		if err != nil {
+			return
+		}
+
+		buffer := &bytes.Buffer{}
+		err = textTemplate.Execute(buffer, data)
+		email.Text = buffer.String()
+	}
+
+	return
+}
+
+// realmEmailTemplatesByLocale returns the templates of a realm by locale and name
+func realmEmailTemplatesByLocale(templates []entity.RealmEmailTemplate) map[string]map[string]entity.RealmEmailTemplate {
+	byLocale := map[string]map[string]entity.RealmEmailTemplate{}
+	for _, template := range templates {
+		if byLocale[template.Locale] == nil {
+			byLocale[template.Locale] = map[string]entity.RealmEmailTemplate{}
+		}
+		byLocale[template.Locale][template.Name] = template
+	}
+
+	return byLocale
+}
+
+func generatePrivateKeyPEM() (pemString string, err error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return
+	}
+
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}
+	pemString = string(pem.EncodeToMemory(block))
+
+	return
+}
+
+func (service *Service) realmResource() {
+	realmGroup := service.Router.Group("/realm")
+	realmGroup.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(context echo.Context) error {
+			if realmFromContext(context).Realm.Name != entity.DefaultRealm {
+				return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+			}
+
+			return next(context)
+		}
+	})
+	canRead := service.requirePermission("realm:read")
+	canWrite := service.requirePermission("realm:write")
+
+	realmGroup.GET("", func(context echo.Context) error {
+		realms, err := entity.LoadRealms(service.DatabaseConnection)
+		if err == nil {
+			return context.JSON(http.StatusOK, realms)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canRead)
+
+	realmGroup.POST("", func(context echo.Context) error {
+		realm := entity.Realm{}
+		err := context.Bind(&realm)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		if !entity.IsValidRealmName(realm.Name) {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\""+entity.ErrInvalidRealmName.Error()+"\"}"))
+		}
+
+		_, err = entity.LoadRealmFromName(service.DatabaseConnection, realm.Name)
+		if err == nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The name was already taken\"}"))
+		}
+
+		realm.PrivateKey, err = generatePrivateKeyPEM()
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return service.saveRealm(context, realm, true)
+	}, canWrite)
+
+	realmGroup.GET("/:name", func(context echo.Context) error {
+		realm, err := entity.LoadRealmFromName(service.DatabaseConnection, context.Param("name"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		return context.JSON(http.StatusOK, realm)
+	}, canRead)
+
+	realmGroup.PUT("/:name", func(context echo.Context) error {
+		realm, err := entity.LoadRealmFromName(service.DatabaseConnection, context.Param("name"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		changes := entity.Realm{}
+		err = context.Bind(&changes)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		// The email templates are only given when the realm is created, after that they are changed with /email-template so that a change of the realm does not replace them
+		realm.Host = changes.Host
+		if changes.Registration != nil {
+			realm.Registration = changes.Registration
+		}
+
+		return service.saveRealm(context, realm, false)
+	}, canWrite)
+}
+
+func (service *Service) saveRealm(context echo.Context, realm entity.Realm, isNew bool) error {
+	realm.Host = strings.ToLower(realm.Host)
+
+	validate := validator.New()
+	err := validate.Struct(realm)
+	if err != nil {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+	}
+
+	for index, template := range realm.EmailTemplates {
+		if !entity.IsValidLocale(template.Locale) {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The locale of an email template is not valid\"}"))
+		}
+		realm.EmailTemplates[index].Locale = normalizeLocale(template.Locale)
+
+		field, err := checkEmailTemplate(template.Name, template.Subject, template.Body, template.Text, serviceURLFromContext(context))
+		if err != nil {
+			return respondWithInvalidEmailTemplate(context, field, err)
+		}
+	}
+
+	if realm.Registration != nil {
+		// The built in roles are created with the realm, any other default role has to exist already
+		customRoles := []string{}
+		for _, role := range realm.Registration.DefaultRoles {
+			if role != "user" && role != "administrator" {
+				customRoles = append(customRoles, role)
+			}
+		}
+
+		_, err = entity.LoadRolesFromNames(entity.InRealm(service.DatabaseConnection, realm.Name), customRoles)
+		if err == entity.ErrUnknownRole {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"One or more of the default roles of the registration does not exist\"}"))
+		} else if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+	}
+
+	if realm.Host != "" {
+		var taken int
+		err = service.DatabaseConnection.Model(&entity.Realm{}).Where("host = ? AND name <> ?", realm.Host, realm.Name).Count(&taken).Error
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		if taken > 0 {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The host is already used by another realm\"}"))
+		}
+	}
+
+	if isNew {
+		err = service.DatabaseConnection.Create(&realm).Error
+	} else {
+		err = service.DatabaseConnection.Save(&realm).Error
+	}
+	if err != nil {
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	err = entity.SetupRealm(service.DatabaseConnection, realm.Name)
+	if err != nil {
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	err = service.loadRealms()
+	if err != nil {
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	if isNew {
+		loaded, exists := service.getRealm(realm.Name)
+		if exists {
+			service.setupAdministratorUserIfMissing(loaded)
+		}
+
+		return context.JSON(http.StatusCreated, realm)
+	}
+
+	return context.JSON(http.StatusOK, realm)
+}
@@ -0,0 +1,269 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/mojlighetsministeriet/utils/jwt"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+// RegistrationSettings controls if accounts can sign up by themselves, which email domains that may do so, the roles they get and if an administrator has to approve them after they have verified their email
+type RegistrationSettings struct {
+	Enabled         bool
+	RequireApproval bool
+	AllowedDomains  []string
+	DeniedDomains   []string
+	DefaultRoles    []string
+}
+
+// IsAllowedEmail returns true if the domain of the email is not denied and, if there are allowed domains, is one of them
+func (settings RegistrationSettings) IsAllowedEmail(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+
+	for _, denied := range settings.DeniedDomains {
+		if strings.ToLower(denied) == domain {
+			return false
+		}
+	}
+
+	if len(settings.AllowedDomains) == 0 {
+		return true
+	}
+
+	for _, allowed := range settings.AllowedDomains {
+		if strings.ToLower(allowed) == domain {
+			return true
+		}
+	}
+
+	return false
+}
+
+// registrationSettings returns the self-registration settings of the realm, the configured settings apply to the default realm until it has settings of its own and other realms do not allow self-registration until they have
+func (service *Service) registrationSettings(realm *loadedRealm) (settings RegistrationSettings) {
+	registration := realm.Realm.Registration
+	if registration == nil {
+		if realm.Realm.Name == entity.DefaultRealm {
+			settings = service.Registration
+		}
+
+		return
+	}
+
+	settings = RegistrationSettings{
+		Enabled:         registration.Enabled,
+		RequireApproval: registration.RequireApproval,
+		AllowedDomains:  registration.AllowedDomains,
+		DeniedDomains:   registration.DeniedDomains,
+		DefaultRoles:    registration.DefaultRoles,
+	}
+	if len(settings.DefaultRoles) == 0 {
+		settings.DefaultRoles = []string{"user"}
+	}
+
+	return
+}
+
+func (service *Service) registrationResource() {
+	registrationGroup := service.Router.Group("/registration")
+	canRead := service.requirePermission("account:read")
+	canWrite := service.requirePermission("account:write")
+
+	registrationGroup.POST("", func(context echo.Context) error {
+		type registrationBody struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+			Locale   string `json:"locale"`
+		}
+
+		realm := realmFromContext(context)
+		settings := service.registrationSettings(realm)
+		if !settings.Enabled {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		parameters := registrationBody{}
+		context.Bind(&parameters)
+
+		if parameters.Password == "" {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		if !entity.IsValidLocale(parameters.Locale) {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The locale must be a language tag such as sv or en-GB\"}"))
+		}
+
+		if !settings.IsAllowedEmail(parameters.Email) {
+			return context.JSONBlob(http.StatusForbidden, []byte("{\"message\":\"Accounts with this email domain cannot sign up\"}"))
+		}
+
+		if rejected, err := service.rejectPassword(context, parameters.Password, parameters.Email); rejected {
+			return err
+		}
+
+		// The response is the same whether the email was taken or not so that it cannot be used to find out which emails that have accounts
+		response := []byte("{\"message\":\"A verification email has been sent\"}")
+
+		_, err := entity.LoadAccountFromEmail(service.realmDatabase(context), parameters.Email)
+		if err == nil {
+			return context.JSONBlob(http.StatusCreated, response)
+		}
+
+		account := entity.Account{
+			RealmID: realm.Realm.Name,
+			Email:   parameters.Email,
+			Locale:  parameters.Locale,
+			Roles:   append([]string{}, settings.DefaultRoles...),
+			Status:  entity.AccountUnverified,
+		}
+		account.BeforeSave()
+
+		err = account.SetPassword(parameters.Password)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		validate := validator.New()
+		err = validate.Struct(account)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		verificationToken, err := jwt.GenerateWithCustomExpiration(
+			realm.Realm.Issuer(),
+			realm.PrivateKey,
+			&entity.Account{Email: account.Email},
+			time.Now().Add(24*time.Hour),
+		)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+		account.SetVerificationToken(string(verificationToken))
+
+		err = service.inTransaction(func(transaction *gorm.DB) error {
+			createErr := transaction.Create(&account).Error
+			if createErr != nil {
+				return createErr
+			}
+
+			return service.queueEmail(
+				transaction,
+				realm,
+				"verify-email",
+				account.Email,
+				account.Locale,
+				struct {
+					ServiceURL        string
+					VerificationToken string
+				}{serviceURLFromContext(context), string(verificationToken)},
+			)
+		})
+		if err != nil {
+			// TODO: handle for non-MySQL databases as well
+			if strings.HasPrefix(err.Error(), "Error 1062") {
+				return context.JSONBlob(http.StatusCreated, response)
+			}
+
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusCreated, response)
+	})
+
+	registrationGroup.POST("/verify", func(context echo.Context) error {
+		claims, err := jwt.GetClaimsFromContextIfValid(&realmFromContext(context).PrivateKey.PublicKey, context)
+		if err != nil {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		email, _ := claims.Get("email").(string)
+		account, err := entity.LoadAccountFromEmail(service.realmDatabase(context), email)
+		if err != nil {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		status := ""
+		if service.registrationSettings(realmFromContext(context)).RequireApproval {
+			status = entity.AccountAwaitingApproval
+		}
+
+		verified, err := account.Verify(service.DatabaseConnection, string(jwt.GetTokenFromContext(context)), status)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		if !verified {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"The verification link has already been used\"}"))
+		}
+
+		if account.Status == entity.AccountAwaitingApproval {
+			return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"The email was verified, the account will be activated when an administrator has approved it\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"The email was verified and the account is activated\"}"))
+	})
+
+	registrationGroup.GET("/pending", func(context echo.Context) error {
+		accounts, err := entity.LoadAccountsAwaitingApproval(service.realmDatabase(context))
+		if err == nil {
+			if accounts == nil {
+				accounts = []entity.Account{}
+			}
+
+			return context.JSON(http.StatusOK, accounts)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canRead)
+
+	registrationGroup.POST("/:id/approve", func(context echo.Context) error {
+		account, err := entity.LoadAccountFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		approved, err := account.Approve(service.DatabaseConnection)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		if !approved {
+			return context.JSONBlob(http.StatusConflict, []byte("{\"message\":\"The account is not awaiting approval\"}"))
+		}
+
+		return context.JSON(http.StatusOK, account)
+	}, canWrite)
+
+	registrationGroup.POST("/:id/reject", func(context echo.Context) error {
+		account, err := entity.LoadAccountFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		rejected, err := account.Reject(service.DatabaseConnection)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		if !rejected {
+			return context.JSONBlob(http.StatusConflict, []byte("{\"message\":\"The account is not awaiting approval\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Rejected\"}"))
+	}, canWrite)
+}
@@ -0,0 +1,126 @@
+package service_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/mojlighetsministeriet/identity-provider/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistrationSettingsIsAllowedEmail(test *testing.T) {
+	settings := service.RegistrationSettings{}
+	assert.True(test, settings.IsAllowedEmail("user@example.com"))
+	assert.False(test, settings.IsAllowedEmail("example.com"))
+
+	settings.DeniedDomains = []string{"spam.example.com"}
+	assert.True(test, settings.IsAllowedEmail("user@example.com"))
+	assert.False(test, settings.IsAllowedEmail("user@SPAM.example.com"))
+
+	settings.AllowedDomains = []string{"example.com"}
+	assert.True(test, settings.IsAllowedEmail("user@example.com"))
+	assert.False(test, settings.IsAllowedEmail("user@example.org"))
+}
+
+func TestRegistrationSignUpVerifyAndApprove(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+	identityService.Registration = service.RegistrationSettings{Enabled: true, RequireApproval: true, DefaultRoles: []string{"user"}}
+
+	administrator := createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	administratorToken := loginTestAccount(test, identityService, administrator.Email)
+
+	response := serveTestRequest(identityService, http.MethodPost, "/registration", "", map[string]string{"email": "user@example.com", "password": testPassword})
+	assert.Equal(test, http.StatusCreated, response.Code)
+	assert.Equal(test, "A verification email has been sent", decodeTestMessage(test, response.Body.Bytes()))
+
+	email := latestTestEmail(test, identityService, "user@example.com")
+	assert.Equal(test, "verify-email", email.Template)
+	verificationToken := latestTestEmailToken(test, identityService, "user@example.com")
+
+	// The account cannot log in before the email is verified
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", map[string]string{"email": "user@example.com", "password": testPassword})
+	assert.NotEqual(test, http.StatusCreated, response.Code)
+
+	// Signing up with an email that is taken responds the same way without sending another email
+	response = serveTestRequest(identityService, http.MethodPost, "/registration", "", map[string]string{"email": "administrator@example.com", "password": testPassword})
+	assert.Equal(test, http.StatusCreated, response.Code)
+	assert.Equal(test, "A verification email has been sent", decodeTestMessage(test, response.Body.Bytes()))
+
+	emails := 0
+	err := identityService.DatabaseConnection.Model(&entity.OutboxEmail{}).Where("recipient = ?", "administrator@example.com").Count(&emails).Error
+	assert.NoError(test, err)
+	assert.Equal(test, 0, emails)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/registration/verify", verificationToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+	assert.Equal(test, "The email was verified, the account will be activated when an administrator has approved it", decodeTestMessage(test, response.Body.Bytes()))
+
+	response = serveTestRequest(identityService, http.MethodPost, "/registration/verify", verificationToken, nil)
+	assert.Equal(test, http.StatusUnauthorized, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", map[string]string{"email": "user@example.com", "password": testPassword})
+	assert.NotEqual(test, http.StatusCreated, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodGet, "/registration/pending", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	var pending []entity.Account
+	err = json.Unmarshal(response.Body.Bytes(), &pending)
+	assert.NoError(test, err)
+	if !assert.Equal(test, 1, len(pending)) {
+		return
+	}
+	assert.Equal(test, "user@example.com", pending[0].Email)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/registration/"+pending[0].ID+"/approve", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/registration/"+pending[0].ID+"/approve", administratorToken, nil)
+	assert.Equal(test, http.StatusConflict, response.Code)
+
+	// An approved account cannot be rejected
+	response = serveTestRequest(identityService, http.MethodPost, "/registration/"+pending[0].ID+"/reject", administratorToken, nil)
+	assert.Equal(test, http.StatusConflict, response.Code)
+
+	loginTestAccount(test, identityService, "user@example.com")
+}
+
+func TestRegistrationRejectLetsTheEmailSignUpAgain(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+	identityService.Registration = service.RegistrationSettings{Enabled: true, RequireApproval: true, DefaultRoles: []string{"user"}}
+
+	administrator := createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	administratorToken := loginTestAccount(test, identityService, administrator.Email)
+
+	response := serveTestRequest(identityService, http.MethodPost, "/registration", "", map[string]string{"email": "user@example.com", "password": testPassword})
+	assert.Equal(test, http.StatusCreated, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/registration/verify", latestTestEmailToken(test, identityService, "user@example.com"), nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	account, err := entity.LoadAccountFromEmail(identityService.DatabaseConnection, "user@example.com")
+	assert.NoError(test, err)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/registration/"+account.ID+"/reject", "", nil)
+	assert.Equal(test, http.StatusUnauthorized, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/registration/"+account.ID+"/reject", administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	// The rejected sign-up is removed for good, it is not kept as a deleted account
+	rejected := 0
+	err = identityService.DatabaseConnection.Unscoped().Model(&entity.Account{}).Where("id = ?", account.ID).Count(&rejected).Error
+	assert.NoError(test, err)
+	assert.Equal(test, 0, rejected)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/registration", "", map[string]string{"email": "user@example.com", "password": testPassword})
+	assert.Equal(test, http.StatusCreated, response.Code)
+
+	account, err = entity.LoadAccountFromEmail(identityService.DatabaseConnection, "user@example.com")
+	assert.NoError(test, err)
+	assert.Equal(test, entity.AccountUnverified, account.Status)
+}
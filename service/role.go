@@ -0,0 +1,182 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+func isBuiltInRole(name string) bool {
+	return name == "administrator" || name == "user"
+}
+
+func (service *Service) validateRoleInclusions(role entity.Role) (err error) {
+	for _, name := range role.Includes {
+		if name == role.Name {
+			return entity.ErrInvalidRoleInclusion
+		}
+	}
+
+	_, err = entity.LoadRolesFromNames(entity.InRealm(service.DatabaseConnection, role.RealmID), role.Includes)
+	return
+}
+
+func (service *Service) roleResource() {
+	roleGroup := service.Router.Group("/role")
+	canRead := service.requirePermission("role:read")
+	canWrite := service.requirePermission("role:write")
+
+	roleGroup.GET("", func(context echo.Context) error {
+		roles, err := entity.LoadRoles(service.realmDatabase(context))
+		if err == nil {
+			return context.JSON(http.StatusOK, roles)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canRead)
+
+	roleGroup.POST("", func(context echo.Context) error {
+		role := entity.Role{}
+		err := context.Bind(&role)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		role.ID = ""
+		role.RealmID = realmFromContext(context).Realm.Name
+		role.BeforeSave()
+
+		validate := validator.New()
+		err = validate.Struct(role)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		err = service.validateRoleInclusions(role)
+		if err == entity.ErrUnknownRole || err == entity.ErrInvalidRoleInclusion {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\""+err.Error()+"\"}"))
+		} else if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		err = service.DatabaseConnection.Create(&role).Error
+		if err != nil {
+			// TODO: handle for non-MySQL databases as well
+			if strings.HasPrefix(err.Error(), "Error 1062") {
+				return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The name was already taken\"}"))
+			}
+
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSON(http.StatusCreated, role)
+	}, canWrite)
+
+	roleGroup.GET("/:id", func(context echo.Context) error {
+		role, err := entity.LoadRoleFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		return context.JSON(http.StatusOK, role)
+	}, canRead)
+
+	roleGroup.PUT("/:id", func(context echo.Context) error {
+		role, err := entity.LoadRoleFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		changes := entity.Role{}
+		err = context.Bind(&changes)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		if isBuiltInRole(role.Name) && changes.Name != role.Name {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Built in roles cannot be renamed\"}"))
+		}
+
+		role.Name = changes.Name
+		role.Description = changes.Description
+		role.Includes = changes.Includes
+		role.Permissions = changes.Permissions
+
+		validate := validator.New()
+		err = validate.Struct(role)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		err = service.validateRoleInclusions(role)
+		if err == entity.ErrUnknownRole || err == entity.ErrInvalidRoleInclusion {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\""+err.Error()+"\"}"))
+		} else if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		err = service.DatabaseConnection.Save(&role).Error
+		if err != nil {
+			// TODO: handle for non-MySQL databases as well
+			if strings.HasPrefix(err.Error(), "Error 1062") {
+				return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The name was already taken\"}"))
+			}
+
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSON(http.StatusOK, role)
+	}, canWrite)
+
+	roleGroup.DELETE("/:id", func(context echo.Context) error {
+		role, err := entity.LoadRoleFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		if isBuiltInRole(role.Name) {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Built in roles cannot be deleted\"}"))
+		}
+
+		err = role.Delete(service.DatabaseConnection)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Deleted\"}"))
+	}, canWrite)
+
+	roleGroup.GET("/:id/accounts", func(context echo.Context) error {
+		role, err := entity.LoadRoleFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		page, err := getPaginationFromContext(context)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\""+err.Error()+"\"}"))
+		}
+
+		accounts, total, err := entity.LoadAccounts(service.realmDatabase(context), entity.AccountQuery{Role: role.Name, Offset: page.Offset(), Limit: page.PerPage})
+		if err == nil {
+			if accounts == nil {
+				accounts = []entity.Account{}
+			}
+
+			setPaginationHeaders(context, page, total)
+			return context.JSON(http.StatusOK, accounts)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canRead, service.requirePermission("account:read"))
+}
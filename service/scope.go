@@ -0,0 +1,120 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	validator "gopkg.in/go-playground/validator.v9"
+)
+
+func (service *Service) scopeResource() {
+	scopeGroup := service.Router.Group("/scope")
+	canRead := service.requirePermission("scope:read")
+	canWrite := service.requirePermission("scope:write")
+
+	scopeGroup.GET("", func(context echo.Context) error {
+		scopes, err := entity.LoadScopes(service.realmDatabase(context))
+		if err == nil {
+			return context.JSON(http.StatusOK, scopes)
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}, canRead)
+
+	scopeGroup.POST("", func(context echo.Context) error {
+		scope := entity.Scope{}
+		err := context.Bind(&scope)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		scope.ID = ""
+		scope.RealmID = realmFromContext(context).Realm.Name
+		scope.BeforeSave()
+
+		return service.saveScope(context, scope, true)
+	}, canWrite)
+
+	scopeGroup.GET("/:id", func(context echo.Context) error {
+		scope, err := entity.LoadScopeFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		return context.JSON(http.StatusOK, scope)
+	}, canRead)
+
+	scopeGroup.PUT("/:id", func(context echo.Context) error {
+		scope, err := entity.LoadScopeFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		changes := entity.Scope{}
+		err = context.Bind(&changes)
+		if err != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+		}
+
+		scope.Name = changes.Name
+		scope.Description = changes.Description
+		scope.Roles = changes.Roles
+
+		return service.saveScope(context, scope, false)
+	}, canWrite)
+
+	scopeGroup.DELETE("/:id", func(context echo.Context) error {
+		scope, err := entity.LoadScopeFromID(service.realmDatabase(context), context.Param("id"))
+		if err != nil {
+			return context.JSONBlob(http.StatusNotFound, []byte("{\"message\":\"Not Found\"}"))
+		}
+
+		err = scope.Delete(service.DatabaseConnection)
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, []byte("{\"message\":\"Deleted\"}"))
+	}, canWrite)
+}
+
+func (service *Service) saveScope(context echo.Context, scope entity.Scope, isNew bool) error {
+	validate := validator.New()
+	err := validate.Struct(scope)
+	if err != nil {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"Bad Request\"}"))
+	}
+
+	_, err = entity.LoadRolesFromNames(service.realmDatabase(context), scope.Roles)
+	if err == entity.ErrUnknownRole {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"One or more of the roles does not exist\"}"))
+	} else if err != nil {
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	if isNew {
+		err = service.DatabaseConnection.Create(&scope).Error
+	} else {
+		err = service.DatabaseConnection.Save(&scope).Error
+	}
+	if err != nil {
+		// TODO: handle for non-MySQL databases as well
+		if strings.HasPrefix(err.Error(), "Error 1062") {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The name was already taken\"}"))
+		}
+
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	if isNew {
+		return context.JSON(http.StatusCreated, scope)
+	}
+
+	return context.JSON(http.StatusOK, scope)
+}
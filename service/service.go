@@ -31,16 +31,40 @@ type EmailTemplates struct {
 
 // Service is the main service that holds web server and database connections and so on
 type Service struct {
-	DatabaseConnection *gorm.DB
-	Router             *echo.Echo
-	PrivateKey         *rsa.PrivateKey
-	Log                echo.Logger
-	TLSConfig          *tls.Config
-	EmailTemplates     emailtemplates.Templates
-	HTTPClient         *httprequest.JSONClient
+	DatabaseConnection          *gorm.DB
+	Router                      *echo.Echo
+	PrivateKey                  *rsa.PrivateKey
+	Log                         echo.Logger
+	TLSConfig                   *tls.Config
+	EmailTemplates              emailtemplates.Templates
+	LocalizedEmailTemplates     *LocalizedEmailTemplates
+	HTTPClient                  *httprequest.JSONClient
+	EmailSender                 EmailSender
+	EmailOutboxInterval         time.Duration
+	EmailRetryDelay             time.Duration
+	EmailMaxAttempts            int
+	AccountRestorePeriod        time.Duration
+	PurgeInterval               time.Duration
+	ExpiryWarningPeriod         time.Duration
+	TokenAttributes             []string
+	ImpersonationLifetime       time.Duration
+	TokenExchangeLifetime       time.Duration
+	DeviceCodeLifetime          time.Duration
+	DevicePollInterval          time.Duration
+	LoginLinkLifetime           time.Duration
+	PasswordChangeTokenLifetime time.Duration
+	Registration                RegistrationSettings
+	PasswordPolicy              entity.PasswordPolicy
+	realms                      realmCache
+	emailTemplates              []emailtemplates.Template
+	defaultEmailTemplates       []emailtemplates.Template
+	stop                        chan struct{}
 }
 
-// Initialize will prepeare the service by connecting to database and creating a web server instance (but it will not start listening until service.Listen() is run)
+// ErrUnnamedEmailTemplate is returned when an email template is added without the name that the service sends it by
+var ErrUnnamedEmailTemplate = errors.New("The email template has no name")
+
+// Initialize will prepeare the service by connecting to database and creating a web server instance (but it will not start listening until service.Listen() is run), set the other email templates with SetEmailTemplates before calling it
 func (service *Service) Initialize(databaseType string, databaseConnectionString string, rsaKeyPEMString string, newAccountTemplate emailtemplates.Template, resetPasswordTemplate emailtemplates.Template) (err error) {
 	service.TLSConfig, err = utils.GetCACertificatesTLSConfig()
 	if err != nil {
@@ -48,28 +72,37 @@ func (service *Service) Initialize(databaseType string, databaseConnectionString
 	}
 
 	service.Router = echo.New()
+	service.Router.Pre(service.realmMiddleware)
 	service.Router.Use(middleware.Gzip())
 
 	service.Log = service.Router.Logger
 	service.Log.SetLevel(log.INFO)
 
 	service.EmailTemplates = emailtemplates.Templates{}
+	service.defaultEmailTemplates = nil
 	newAccountTemplate.Name = "new-account"
-	service.EmailTemplates.Add(newAccountTemplate)
+	service.addEmailTemplate(newAccountTemplate)
 	resetPasswordTemplate.Name = "reset-password"
-	service.EmailTemplates.Add(resetPasswordTemplate)
+	service.addEmailTemplate(resetPasswordTemplate)
+	for _, emailTemplate := range service.emailTemplates {
+		service.addEmailTemplate(emailTemplate)
+	}
 
 	service.HTTPClient, err = httprequest.NewJSONClient()
 	if err != nil {
 		return
 	}
 
+	if service.EmailSender == nil {
+		service.EmailSender = &HTTPEmailSender{URL: "http://email", Client: service.HTTPClient}
+	}
+
 	service.DatabaseConnection, err = gorm.Open(databaseType, databaseConnectionString)
 	if err != nil {
 		return
 	}
 
-	err = service.DatabaseConnection.AutoMigrate(&entity.Account{}).Error
+	err = entity.AutoMigrate(service.DatabaseConnection)
 	if err != nil {
 		return
 	}
@@ -81,9 +114,94 @@ func (service *Service) Initialize(databaseType string, databaseConnectionString
 		}
 	}
 
-	service.setupAdministratorUserIfMissing()
+	err = service.loadRealms()
+	if err != nil {
+		return
+	}
+
+	service.realms.RLock()
+	for _, realm := range service.realms.byName {
+		service.setupAdministratorUserIfMissing(realm)
+	}
+	service.realms.RUnlock()
+
+	if service.AccountRestorePeriod == 0 {
+		service.AccountRestorePeriod = time.Duration(30*24) * time.Hour
+	}
+	if service.PurgeInterval == 0 {
+		service.PurgeInterval = time.Hour
+	}
+
+	if service.ExpiryWarningPeriod == 0 {
+		service.ExpiryWarningPeriod = time.Duration(7*24) * time.Hour
+	}
+
+	if service.ImpersonationLifetime == 0 {
+		service.ImpersonationLifetime = 15 * time.Minute
+	}
+
+	if service.TokenExchangeLifetime == 0 {
+		service.TokenExchangeLifetime = 5 * time.Minute
+	}
+
+	if service.DeviceCodeLifetime == 0 {
+		service.DeviceCodeLifetime = 10 * time.Minute
+	}
+
+	if service.DevicePollInterval == 0 {
+		service.DevicePollInterval = 5 * time.Second
+	}
+
+	if service.LoginLinkLifetime == 0 {
+		service.LoginLinkLifetime = 15 * time.Minute
+	}
+
+	if service.PasswordChangeTokenLifetime == 0 {
+		service.PasswordChangeTokenLifetime = 10 * time.Minute
+	}
+
+	if service.EmailOutboxInterval == 0 {
+		service.EmailOutboxInterval = 5 * time.Second
+	}
+
+	if service.EmailRetryDelay == 0 {
+		service.EmailRetryDelay = 30 * time.Second
+	}
+
+	if service.EmailMaxAttempts == 0 {
+		service.EmailMaxAttempts = 8
+	}
+
+	if service.PasswordPolicy == (entity.PasswordPolicy{}) {
+		service.PasswordPolicy = entity.DefaultPasswordPolicy()
+	}
+
+	if service.Registration.DefaultRoles == nil {
+		service.Registration.DefaultRoles = []string{"user"}
+	}
+
+	service.stop = make(chan struct{})
+	service.runPeriodically(service.PurgeInterval, service.purgeDeletedAccounts)
+	service.runPeriodically(service.PurgeInterval, service.sendExpiryWarnings)
+	service.runPeriodically(service.PurgeInterval, service.purgeExpiredDeviceAuthorizations)
+	service.runPeriodically(service.PurgeInterval, service.purgeSentEmails)
+	service.runPeriodically(service.EmailOutboxInterval, service.deliverQueuedEmails)
 
 	service.accountResource()
+	service.roleResource()
+	service.groupResource()
+	service.organizationResource()
+	service.invitationResource()
+	service.outboxResource()
+	service.emailTemplateResource()
+	service.registrationResource()
+	service.passwordResource()
+	service.impersonationResource()
+	service.scopeResource()
+	service.clientResource()
+	service.consentResource()
+	service.deviceResource()
+	service.realmResource()
 	service.tokenResource()
 	service.publicKeyResource()
 	service.indexResource()
@@ -91,6 +209,49 @@ func (service *Service) Initialize(databaseType string, databaseConnectionString
 	return
 }
 
+// SetEmailTemplates sets the email templates that the service sends besides new-account and reset-password, i.e. account-expiring, login-link and verify-email, call it before Initialize. A template without a name is refused since the service sends the templates by name.
+func (service *Service) SetEmailTemplates(emailTemplates ...emailtemplates.Template) error {
+	for _, emailTemplate := range emailTemplates {
+		if emailTemplate.Name == "" {
+			return ErrUnnamedEmailTemplate
+		}
+	}
+
+	service.emailTemplates = emailTemplates
+	return nil
+}
+
+func (service *Service) addEmailTemplate(emailTemplate emailtemplates.Template) {
+	service.EmailTemplates.Add(emailTemplate)
+
+	for index, defaultTemplate := range service.defaultEmailTemplates {
+		if defaultTemplate.Name == emailTemplate.Name {
+			service.defaultEmailTemplates[index] = emailTemplate
+			return
+		}
+	}
+
+	service.defaultEmailTemplates = append(service.defaultEmailTemplates, emailTemplate)
+}
+
+// inTransaction runs the function in a database transaction that is committed if the function returns nil and otherwise rolled back
+func (service *Service) inTransaction(function func(transaction *gorm.DB) error) (err error) {
+	transaction := service.DatabaseConnection.Begin()
+	err = transaction.Error
+	if err != nil {
+		return
+	}
+
+	err = function(transaction)
+	if err != nil {
+		transaction.Rollback()
+		return
+	}
+
+	err = transaction.Commit().Error
+	return
+}
+
 // Listen will make the service start listning for incoming requests
 func (service *Service) Listen(address string) (err error) {
 	err = service.Router.Start(address)
@@ -99,25 +260,35 @@ func (service *Service) Listen(address string) (err error) {
 
 // Close will shut down the service and any of it's related components
 func (service *Service) Close() {
+	if service.stop != nil {
+		close(service.stop)
+		service.stop = nil
+	}
+
+	if service.PasswordPolicy.BreachedPasswords != nil {
+		service.PasswordPolicy.BreachedPasswords.Close()
+	}
+
 	service.DatabaseConnection.Close()
 }
 
-func (service *Service) setupAdministratorUserIfMissing() (err error) {
-	administrator := entity.Account{}
-
-	err = service.DatabaseConnection.Where("roles_serialized LIKE (?)", "administrator").First(&administrator).Error
-	if err == nil || err.Error() != "record not found" {
+func (service *Service) setupAdministratorUserIfMissing(realm *loadedRealm) (err error) {
+	_, administrators, err := entity.LoadAccounts(entity.InRealm(service.DatabaseConnection, realm.Realm.Name), entity.AccountQuery{Role: "administrator", Limit: 1})
+	if err != nil || administrators > 0 {
 		return
 	}
 
+	administrator := entity.Account{}
+
 	administrator.ID = uuid.Must(uuid.NewV4()).String()
+	administrator.RealmID = realm.Realm.Name
 	administrator.Email = "administrator@identity-provider.localhost"
 	administrator.Roles = []string{"user", "administrator"}
 
 	expiration := time.Now().Add(time.Duration(3600) * time.Second)
 	resetToken, err := jwt.GenerateWithCustomExpiration(
-		"identity-provider",
-		service.PrivateKey,
+		realm.Realm.Issuer(),
+		realm.PrivateKey,
 		&administrator,
 		expiration,
 	)
@@ -133,7 +304,7 @@ func (service *Service) setupAdministratorUserIfMissing() (err error) {
 	err = service.DatabaseConnection.Create(&administrator).Error
 	if err == nil {
 		// TODO: Change instructions to work with refactored version of the end points
-		service.Log.Info(fmt.Sprintf("No account with administrator found, created a new account with email %s and reset token %s, reset password by POST account/reset-token/password Authorization: Bearer %s { \"password\": \"yournewpassword\" }", administrator.Email, string(resetToken), string(resetToken)))
+		service.Log.Info(fmt.Sprintf("No account with administrator found in realm %s, created a new account with email %s and reset token %s, reset password by POST account/reset-token/password Authorization: Bearer %s { \"password\": \"yournewpassword\" }", realm.Realm.Name, administrator.Email, string(resetToken), string(resetToken)))
 	}
 
 	return
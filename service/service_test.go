@@ -1,14 +1,21 @@
 package service_test
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
 	"github.com/mojlighetsministeriet/identity-provider/service"
 	"github.com/mojlighetsministeriet/utils/emailtemplates"
 	uuid "github.com/satori/go.uuid"
@@ -28,3 +35,136 @@ func TestServiceInitialize(test *testing.T) {
 	err = identityService.Initialize("sqlite3", storage, pem, emailtemplates.Template{}, emailtemplates.Template{})
 	assert.NoError(test, err)
 }
+
+func TestServiceSetEmailTemplates(test *testing.T) {
+	identityService := service.Service{}
+	err := identityService.SetEmailTemplates(emailtemplates.Template{Name: "login-link", Subject: "Log in"}, emailtemplates.Template{Subject: "Unnamed"})
+	assert.Equal(test, service.ErrUnnamedEmailTemplate, err)
+
+	err = identityService.SetEmailTemplates(emailtemplates.Template{Name: "login-link", Subject: "Log in", Body: "Log in"})
+	assert.NoError(test, err)
+}
+
+// testPassword satisfies the default password policy
+const testPassword = "correct-horse-battery-staple"
+
+// newTestService initializes a service with a new database and the new-account, reset-password and login-link templates, the emails stay in the outbox so that the tests can read them, call the returned function to close it
+func newTestService(test *testing.T) (identityService *service.Service, cleanup func()) {
+	storage := "test-storage-" + uuid.Must(uuid.NewV4()).String() + ".db"
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(test, err)
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}
+
+	identityService = &service.Service{EmailOutboxInterval: time.Hour}
+	err = identityService.SetEmailTemplates(
+		emailtemplates.Template{Name: "login-link", Subject: "Log in", Body: "<a href=\"{{.ServiceURL}}/login?token={{.LoginToken}}\">Log in</a>"},
+		emailtemplates.Template{Name: "verify-email", Subject: "Verify your email", Body: "<a href=\"{{.ServiceURL}}/verify-email?token={{.VerificationToken}}\">Verify your email</a>"},
+	)
+	assert.NoError(test, err)
+
+	err = identityService.Initialize(
+		"sqlite3",
+		storage,
+		string(pem.EncodeToMemory(block)),
+		emailtemplates.Template{Subject: "Welcome", Body: "<a href=\"{{.ServiceURL}}/reset-password?token={{.ResetToken}}\">Choose a password</a>"},
+		emailtemplates.Template{Subject: "Reset your password", Body: "<a href=\"{{.ServiceURL}}/reset-password?token={{.ResetToken}}\">Choose a new password</a>"},
+	)
+	assert.NoError(test, err)
+
+	return identityService, func() {
+		identityService.Close()
+		os.Remove(storage)
+	}
+}
+
+// createTestAccount persists an account in the default realm with testPassword as its password
+func createTestAccount(test *testing.T, identityService *service.Service, account entity.Account) entity.Account {
+	err := account.SetPassword(testPassword)
+	assert.NoError(test, err)
+
+	err = identityService.DatabaseConnection.Create(&account).Error
+	assert.NoError(test, err)
+
+	return account
+}
+
+// serveTestRequest sends the request, with the body as JSON if it is not nil, to the service and returns the response
+func serveTestRequest(identityService *service.Service, method string, path string, token string, body interface{}) *httptest.ResponseRecorder {
+	payload := []byte{}
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+
+	request := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	request.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	response := httptest.NewRecorder()
+	identityService.Router.ServeHTTP(response, request)
+
+	return response
+}
+
+// loginTestAccount returns a token for the account with testPassword
+func loginTestAccount(test *testing.T, identityService *service.Service, email string) string {
+	response := serveTestRequest(identityService, http.MethodPost, "/token", "", map[string]string{"email": email, "password": testPassword})
+	assert.Equal(test, http.StatusCreated, response.Code)
+
+	return decodeTestTokenResponse(test, response.Body.Bytes())
+}
+
+// decodeTestTokenResponse returns the token of a response from one of the token end points
+func decodeTestTokenResponse(test *testing.T, body []byte) string {
+	var response struct {
+		Token string `json:"token"`
+	}
+	err := json.Unmarshal(body, &response)
+	assert.NoError(test, err)
+
+	return response.Token
+}
+
+// decodeTestToken returns the claims of a token that the service considers valid
+func decodeTestToken(test *testing.T, identityService *service.Service, token string) (claims map[string]interface{}) {
+	response := serveTestRequest(identityService, http.MethodPost, "/token/decode", token, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	err := json.Unmarshal(response.Body.Bytes(), &claims)
+	assert.NoError(test, err)
+
+	return
+}
+
+// decodeTestMessage returns the message of a response body
+func decodeTestMessage(test *testing.T, body []byte) string {
+	var response struct {
+		Message string `json:"message"`
+	}
+	err := json.Unmarshal(body, &response)
+	assert.NoError(test, err)
+
+	return response.Message
+}
+
+// latestTestEmail returns the email that was queued last for the recipient
+func latestTestEmail(test *testing.T, identityService *service.Service, recipient string) (email entity.OutboxEmail) {
+	err := identityService.DatabaseConnection.Where("recipient = ?", recipient).Order("created_at desc").First(&email).Error
+	assert.NoError(test, err)
+
+	return
+}
+
+// latestTestEmailToken returns the token of the link in the email that was queued last for the recipient
+func latestTestEmailToken(test *testing.T, identityService *service.Service, recipient string) string {
+	body := latestTestEmail(test, identityService, recipient).Body
+	start := strings.Index(body, "token=")
+	if !assert.True(test, start >= 0) {
+		return ""
+	}
+
+	token := body[start+len("token="):]
+	return token[:strings.Index(token, "\"")]
+}
@@ -2,7 +2,12 @@ package service
 
 import (
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/SermoDigital/jose/crypto"
+	"github.com/SermoDigital/jose/jws"
+	"github.com/jinzhu/gorm"
 	"github.com/labstack/echo"
 	"github.com/mojlighetsministeriet/identity-provider/entity"
 	"github.com/mojlighetsministeriet/utils/jwt"
@@ -14,61 +19,161 @@ func (service *Service) tokenResource() {
 
 	tokenGroup.POST("", func(context echo.Context) error {
 		type createTokenBody struct {
-			Email    string `json:"email"`
-			Password string `json:"password"`
+			Email            string `json:"email" form:"email"`
+			Password         string `json:"password" form:"password"`
+			GrantType        string `json:"grant_type" form:"grant_type"`
+			SubjectToken     string `json:"subject_token" form:"subject_token"`
+			SubjectTokenType string `json:"subject_token_type" form:"subject_token_type"`
+			Audience         string `json:"audience" form:"audience"`
+			Roles            string `json:"roles" form:"roles"`
+			ClientID         string `json:"client_id" form:"client_id"`
+			ClientSecret     string `json:"client_secret" form:"client_secret"`
+			Scope            string `json:"scope" form:"scope"`
+			DeviceCode       string `json:"device_code" form:"device_code"`
 		}
 
 		parameters := createTokenBody{}
 		context.Bind(&parameters)
 
+		if parameters.GrantType == tokenExchangeGrantType {
+			return service.exchangeToken(context, tokenExchangeRequest{
+				SubjectToken:     parameters.SubjectToken,
+				SubjectTokenType: parameters.SubjectTokenType,
+				Audience:         parameters.Audience,
+				Roles:            strings.Fields(parameters.Roles),
+			})
+		}
+
+		if parameters.GrantType == deviceCodeGrantType {
+			return service.redeemDeviceCode(context, parameters.DeviceCode, parameters.ClientID)
+		}
+
+		if parameters.ClientID != "" && !service.authenticateClient(context, parameters.ClientID, parameters.ClientSecret) {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"The client could not be authenticated\"}"))
+		}
+
 		// TODO: Add validation to input parameters
 		// Set an invalid password if password was empty
 		if parameters.Password == "" {
 			parameters.Password = uuid.Must(uuid.NewV4()).String()
 		}
 
-		account, err := entity.LoadAccountFromEmailAndPassword(service.DatabaseConnection, parameters.Email, parameters.Password)
+		account, err := entity.LoadAccountFromEmailAndPassword(service.realmDatabase(context), parameters.Email, parameters.Password)
+		if err != nil || !account.CanAuthenticate() {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		return service.respondWithToken(context, account, parameters.ClientID, strings.Fields(parameters.Scope), http.StatusForbidden, respondWithTokenBody)
+	})
+
+	tokenGroup.POST("/renew", func(context echo.Context) error {
+		parsedToken, err := jwt.ParseIfValid(&realmFromContext(context).PrivateKey.PublicKey, jwt.GetTokenFromContext(context))
 		if err != nil {
 			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
 		}
 
-		newToken, err := jwt.Generate("identity-provider", service.PrivateKey, &account)
+		// Impersonation, exchanged and password change tokens are short-lived and restricted on purpose and cannot be renewed
+		tokenUse := parsedToken.Claims().Get("token_use")
+		if parsedToken.Claims().Get("act") != nil || tokenUse == tokenUseExchange || tokenUse == tokenUsePasswordChange {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		id := parsedToken.Claims().Get("sub").(string)
+		account, err := entity.LoadAccountFromID(service.realmDatabase(context), id)
+		if err != nil || !account.CanAuthenticate() {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
+		}
+
+		clientID, _ := parsedToken.Claims().Get("azp").(string)
+		scope, _ := parsedToken.Claims().Get("scope").(string)
+
+		return service.respondWithToken(context, account, clientID, strings.Fields(scope), http.StatusUnauthorized, respondWithTokenBody)
+	})
+
+	tokenGroup.POST("/email-link", func(context echo.Context) error {
+		type emailBody struct {
+			Email string `json:"email"`
+		}
+
+		parameters := emailBody{}
+		context.Bind(&parameters)
+
+		// The response is the same whether the account exists or not so that it cannot be used to find out which emails that have accounts
+		response := []byte("{\"message\":\"If there is an account with the email a login link has been sent to it\"}")
+
+		account, err := entity.LoadAccountFromEmail(service.realmDatabase(context), parameters.Email)
+		if err != nil || account.Email != parameters.Email || !account.CanAuthenticate() {
+			return context.JSONBlob(http.StatusOK, response)
+		}
+
+		// Like reset tokens the login token only identifies the account by email so that it cannot be renewed into an access token
+		realm := realmFromContext(context)
+		loginToken, err := jwt.GenerateWithCustomExpiration(
+			realm.Realm.Issuer(),
+			realm.PrivateKey,
+			&entity.Account{Email: account.Email},
+			time.Now().Add(service.LoginLinkLifetime),
+		)
 		if err != nil {
 			service.Log.Error(err)
 			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
 		}
 
-		return context.JSON(http.StatusCreated, struct {
-			Token string `json:"token"`
-		}{Token: string(newToken)})
+		account.SetLoginLinkToken(string(loginToken))
+		err = service.inTransaction(func(transaction *gorm.DB) error {
+			updateErr := transaction.Model(&account).UpdateColumn("login_link_token", account.LoginLinkToken).Error
+			if updateErr != nil {
+				return updateErr
+			}
+
+			return service.queueEmail(
+				transaction,
+				realm,
+				"login-link",
+				account.Email,
+				account.Locale,
+				struct {
+					ServiceURL string
+					LoginToken string
+				}{serviceURLFromContext(context), string(loginToken)},
+			)
+		})
+		if err != nil {
+			service.Log.Error(err)
+			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+		}
+
+		return context.JSONBlob(http.StatusOK, response)
 	})
 
-	tokenGroup.POST("/renew", func(context echo.Context) error {
-		parsedToken, err := jwt.ParseIfValid(&service.PrivateKey.PublicKey, jwt.GetTokenFromContext(context))
+	tokenGroup.POST("/email-link/redeem", func(context echo.Context) error {
+		claims, err := jwt.GetClaimsFromContextIfValid(&realmFromContext(context).PrivateKey.PublicKey, context)
 		if err != nil {
 			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
 		}
 
-		id := parsedToken.Claims().Get("sub").(string)
-		account, err := entity.LoadAccountFromID(service.DatabaseConnection, id)
-		if err != nil {
+		email, _ := claims.Get("email").(string)
+		account, err := entity.LoadAccountFromEmail(service.realmDatabase(context), email)
+		if err != nil || !account.CanAuthenticate() {
 			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"Unauthorized\"}"))
 		}
 
-		newToken, err := jwt.Generate("identity-provider", service.PrivateKey, &account)
+		redeemed, err := account.RedeemLoginLinkToken(service.DatabaseConnection, string(jwt.GetTokenFromContext(context)))
 		if err != nil {
 			service.Log.Error(err)
 			return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
 		}
 
-		return context.JSON(http.StatusCreated, struct {
-			Token string `json:"token"`
-		}{Token: string(newToken)})
+		if !redeemed {
+			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"The login link has already been used or has been replaced by a newer one\"}"))
+		}
+
+		return service.respondWithToken(context, account, "", nil, http.StatusForbidden, respondWithTokenBody)
 	})
 
 	tokenGroup.POST("/decode", func(context echo.Context) error {
-		parsedToken, err := jwt.ParseIfValid(&service.PrivateKey.PublicKey, jwt.GetTokenFromContext(context))
-		if err != nil {
+		parsedToken, err := jwt.ParseIfValid(&realmFromContext(context).PrivateKey.PublicKey, jwt.GetTokenFromContext(context))
+		if err != nil || service.isRevokedImpersonation(parsedToken.Claims()) {
 			return context.JSONBlob(http.StatusUnauthorized, []byte("{\"message\":\"The token is invalid\"}"))
 		}
 
@@ -80,3 +185,166 @@ func (service *Service) tokenResource() {
 		return context.JSONBlob(http.StatusOK, json)
 	})
 }
+
+// tokenResponder writes the response with a token that was issued for an account, passwordChangeRequired is true if it is a password change token
+type tokenResponder func(context echo.Context, token []byte, passwordChangeRequired bool) error
+
+// respondWithTokenBody responds with the token as the token end points of the service always have
+func respondWithTokenBody(context echo.Context, token []byte, passwordChangeRequired bool) error {
+	return context.JSON(http.StatusCreated, struct {
+		Token                  string `json:"token"`
+		PasswordChangeRequired bool   `json:"passwordChangeRequired,omitempty"`
+	}{Token: string(token), PasswordChangeRequired: passwordChangeRequired})
+}
+
+// respondWithAccessTokenResponse responds with the token as an access token response (see RFC 6749 section 5.1) that the grants from later RFCs, e.g. the device authorization grant, require
+func respondWithAccessTokenResponse(context echo.Context, token []byte, passwordChangeRequired bool) error {
+	var expiresIn int64
+	if parsedToken, err := jws.ParseJWT(token); err == nil {
+		if expiresAt, exists := parsedToken.Claims().Expiration(); exists {
+			expiresIn = int64(time.Until(expiresAt).Seconds())
+		}
+	}
+
+	return context.JSON(http.StatusOK, struct {
+		AccessToken            string `json:"access_token"`
+		TokenType              string `json:"token_type"`
+		ExpiresIn              int64  `json:"expires_in"`
+		PasswordChangeRequired bool   `json:"password_change_required,omitempty"`
+	}{AccessToken: string(token), TokenType: "Bearer", ExpiresIn: expiresIn, PasswordChangeRequired: passwordChangeRequired})
+}
+
+// respondWithToken responds with a new token for the account through respond, if a client id is given the token is issued for that client and its scopes and if the account has not consented to them the response has the consentRequiredStatus and lists the scopes that are missing consent. An account that has to change its password gets a password change token instead, whichever way it logged in or renewed its token.
+func (service *Service) respondWithToken(context echo.Context, account entity.Account, clientID string, scopes []string, consentRequiredStatus int, respond tokenResponder) error {
+	if account.RequiresPasswordChange(service.PasswordPolicy.MaximumAge) {
+		return service.respondWithPasswordChangeToken(context, account, respond)
+	}
+
+	realm := realmFromContext(context)
+
+	var newToken []byte
+	var err error
+	if clientID == "" {
+		newToken, err = service.generateAccessToken(realm, account)
+	} else {
+		client, clientErr := entity.LoadClientFromID(service.realmDatabase(context), clientID)
+		if clientErr != nil {
+			return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The client does not exist\"}"))
+		}
+
+		var missingConsent []string
+		newToken, missingConsent, err = service.generateClientAccessToken(realm, account, client, scopes)
+		if err == nil && len(missingConsent) > 0 {
+			return context.JSON(consentRequiredStatus, struct {
+				Message  string   `json:"message"`
+				ClientID string   `json:"clientId"`
+				Scopes   []string `json:"scopes"`
+			}{Message: "Consent is required", ClientID: client.ID, Scopes: missingConsent})
+		}
+	}
+
+	if err != nil {
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	return respond(context, newToken, false)
+}
+
+// tokenClaims are added to, or replaces, the standard claims of a token
+type tokenClaims map[string]interface{}
+
+// signToken generates a token for the account with the standard claims from jwt.Generate and then adds the extra claims before signing it with the key of the realm
+func (service *Service) signToken(realm *loadedRealm, account *entity.Account, claims tokenClaims) (token []byte, err error) {
+	token, err = jwt.Generate(realm.Realm.Issuer(), realm.PrivateKey, account)
+	if err != nil || len(claims) == 0 {
+		return
+	}
+
+	parsedToken, err := jws.ParseJWT(token)
+	if err != nil {
+		return
+	}
+
+	mergedClaims := jws.Claims(parsedToken.Claims())
+	for key, value := range claims {
+		mergedClaims.Set(key, value)
+	}
+
+	token, err = jws.NewJWT(mergedClaims, crypto.SigningMethodRS256).Serialize(realm.PrivateKey)
+	return
+}
+
+// generateAccessToken generates a token for the account with the claims from accessTokenClaims
+func (service *Service) generateAccessToken(realm *loadedRealm, account entity.Account) (token []byte, err error) {
+	effectiveRoles, claims, err := service.accessTokenClaims(realm, account)
+	if err != nil {
+		return
+	}
+
+	account.Roles = effectiveRoles
+
+	token, err = service.signToken(realm, &account, claims)
+	return
+}
+
+// accessTokenClaims returns the accounts effective roles (assigned directly, through groups and the roles that they include) and the claims where permissions contains all permissions granted by them, groups the names of the groups that the account is a member of, orgs maps the id of each organization that the account is a member of to its role there and attributes holds the account attributes that are listed in service.TokenAttributes
+func (service *Service) accessTokenClaims(realm *loadedRealm, account entity.Account) (effectiveRoles []string, claims tokenClaims, err error) {
+	realmDatabase := entity.InRealm(service.DatabaseConnection, realm.Realm.Name)
+
+	groups, err := entity.LoadGroupsForAccount(realmDatabase, account.ID)
+	if err != nil {
+		return
+	}
+
+	roles := append([]string{}, account.Roles...)
+	groupNames := []string{}
+	for _, group := range groups {
+		roles = append(roles, group.Roles...)
+		groupNames = append(groupNames, group.Name)
+	}
+
+	effectiveRoles, permissions, err := entity.LoadEffectiveRolesAndPermissions(realmDatabase, roles)
+	if err != nil {
+		return
+	}
+
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	claims = tokenClaims{"permissions": permissions, "groups": groupNames}
+
+	memberships, err := entity.LoadOrganizationMembershipsForAccount(service.DatabaseConnection, account.ID)
+	if err != nil {
+		return
+	}
+
+	if len(memberships) > 0 {
+		organizations := map[string]string{}
+		for _, membership := range memberships {
+			organizations[membership.OrganizationID] = membership.Role
+		}
+		claims["orgs"] = organizations
+	}
+
+	if len(service.TokenAttributes) > 0 {
+		var attributes map[string]string
+		attributes, err = entity.LoadAccountAttributes(service.DatabaseConnection, account.ID)
+		if err != nil {
+			return
+		}
+
+		allowedAttributes := map[string]string{}
+		for _, key := range service.TokenAttributes {
+			if value, exists := attributes[key]; exists {
+				allowedAttributes[key] = value
+			}
+		}
+		if len(allowedAttributes) > 0 {
+			claims["attributes"] = allowedAttributes
+		}
+	}
+
+	return
+}
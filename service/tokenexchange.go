@@ -0,0 +1,121 @@
+package service
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/mojlighetsministeriet/utils/jwt"
+)
+
+const tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+const jwtTokenType = "urn:ietf:params:oauth:token-type:jwt"
+const accessTokenType = "urn:ietf:params:oauth:token-type:access_token"
+
+// tokenUseExchange is the value of the token_use claim of tokens issued by a token exchange, they cannot be renewed
+const tokenUseExchange = "exchange"
+
+// tokenExchangeRequest holds the parameters of a RFC 8693 token exchange, roles is the subset of the subject tokens roles that the new token should have
+type tokenExchangeRequest struct {
+	SubjectToken     string
+	SubjectTokenType string
+	Audience         string
+	Roles            []string
+}
+
+// exchangeToken issues a token for the subject of a valid token that is restricted to the audience and a subset of the roles, it expires after service.TokenExchangeLifetime or together with the subject token if that is sooner
+func (service *Service) exchangeToken(context echo.Context, request tokenExchangeRequest) error {
+	if request.SubjectTokenType != jwtTokenType && request.SubjectTokenType != accessTokenType {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The subject_token_type is not supported\"}"))
+	}
+
+	if request.Audience == "" {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The audience is required\"}"))
+	}
+
+	realm := realmFromContext(context)
+	subjectToken, err := jwt.ParseIfValid(&realm.PrivateKey.PublicKey, []byte(request.SubjectToken))
+	if err != nil || service.isRevokedImpersonation(subjectToken.Claims()) {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The subject_token is invalid\"}"))
+	}
+
+	// A password change token only grants changing the password so there is nothing in it to exchange
+	subjectClaims := subjectToken.Claims()
+	if subjectClaims.Get("token_use") == tokenUsePasswordChange {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The subject_token is invalid\"}"))
+	}
+
+	id, _ := subjectClaims.Get("sub").(string)
+	account, err := entity.LoadAccountFromID(service.realmDatabase(context), id)
+	if err != nil || !account.CanAuthenticate() {
+		return context.JSONBlob(http.StatusBadRequest, []byte("{\"message\":\"The subject_token is invalid\"}"))
+	}
+
+	// The subject token may have been issued before the account was required to change its password or before the password expired
+	if account.RequiresPasswordChange(service.PasswordPolicy.MaximumAge) {
+		return context.JSONBlob(http.StatusForbidden, []byte("{\"message\":\"The password of the account has to be changed\"}"))
+	}
+
+	for _, role := range request.Roles {
+		if !claimContains(subjectClaims.Get("roles"), role) {
+			return context.JSON(http.StatusBadRequest, struct {
+				Message string `json:"message"`
+			}{Message: "The subject_token does not have the role " + role})
+		}
+	}
+
+	effectiveRoles, permissions, err := entity.LoadEffectiveRolesAndPermissions(service.realmDatabase(context), request.Roles)
+	if err != nil {
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	// Roles that has been given to an included role after the subject token was issued must not be gained by exchanging it
+	account.Roles = []string{}
+	for _, role := range effectiveRoles {
+		if claimContains(subjectClaims.Get("roles"), role) {
+			account.Roles = append(account.Roles, role)
+		}
+	}
+
+	if permissions == nil {
+		permissions = []string{}
+	}
+
+	expiresAt := time.Now().Add(service.TokenExchangeLifetime)
+	if subjectExpiresAt, exists := subjectClaims.Expiration(); exists && subjectExpiresAt.Before(expiresAt) {
+		expiresAt = subjectExpiresAt
+	}
+
+	claims := tokenClaims{
+		"aud":         request.Audience,
+		"exp":         expiresAt.Unix(),
+		"permissions": permissions,
+		"token_use":   tokenUseExchange,
+	}
+
+	// An exchanged impersonation token stays an impersonation token so that it can still be revoked
+	if subjectClaims.Get("act") != nil {
+		claims["act"] = subjectClaims.Get("act")
+		claims["jti"] = subjectClaims.Get("jti")
+	}
+
+	token, err := service.signToken(realm, &account, claims)
+	if err != nil {
+		service.Log.Error(err)
+		return context.JSONBlob(http.StatusInternalServerError, []byte("{\"message\":\"Internal Server Error\"}"))
+	}
+
+	return context.JSON(http.StatusOK, struct {
+		AccessToken     string `json:"access_token"`
+		IssuedTokenType string `json:"issued_token_type"`
+		TokenType       string `json:"token_type"`
+		ExpiresIn       int64  `json:"expires_in"`
+	}{
+		AccessToken:     string(token),
+		IssuedTokenType: jwtTokenType,
+		TokenType:       "Bearer",
+		ExpiresIn:       int64(time.Until(expiresAt).Seconds()),
+	})
+}
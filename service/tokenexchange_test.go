@@ -0,0 +1,171 @@
+package service_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mojlighetsministeriet/identity-provider/entity"
+	"github.com/stretchr/testify/assert"
+)
+
+const tokenExchangeGrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
+const jwtTokenType = "urn:ietf:params:oauth:token-type:jwt"
+
+type tokenExchangeResponse struct {
+	AccessToken     string `json:"access_token"`
+	IssuedTokenType string `json:"issued_token_type"`
+	ExpiresIn       int64  `json:"expires_in"`
+}
+
+func exchangeTestToken(subjectToken string, roles string) map[string]string {
+	return exchangeTestTokenForAudience(subjectToken, roles, "billing")
+}
+
+func exchangeTestTokenForAudience(subjectToken string, roles string, audience string) map[string]string {
+	return map[string]string{
+		"grant_type":         tokenExchangeGrantType,
+		"subject_token":      subjectToken,
+		"subject_token_type": jwtTokenType,
+		"audience":           audience,
+		"roles":              roles,
+	}
+}
+
+func TestTokenExchangeGivesASubsetOfTheRoles(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	createTestAccount(test, identityService, entity.Account{Email: "user@example.com", Roles: []string{"user", "administrator"}})
+	subjectToken := loginTestAccount(test, identityService, "user@example.com")
+
+	response := serveTestRequest(identityService, http.MethodPost, "/token", "", exchangeTestToken(subjectToken, "user"))
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	exchanged := tokenExchangeResponse{}
+	err := json.Unmarshal(response.Body.Bytes(), &exchanged)
+	assert.NoError(test, err)
+	assert.Equal(test, jwtTokenType, exchanged.IssuedTokenType)
+
+	claims := decodeTestToken(test, identityService, exchanged.AccessToken)
+	assert.Equal(test, []interface{}{"user"}, claims["roles"])
+	assert.Equal(test, []interface{}{}, claims["permissions"])
+	assert.Equal(test, "billing", claims["aud"])
+	assert.Equal(test, "exchange", claims["token_use"])
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", exchangeTestToken(subjectToken, "user auditor"))
+	assert.Equal(test, http.StatusBadRequest, response.Code)
+	assert.Equal(test, "The subject_token does not have the role auditor", decodeTestMessage(test, response.Body.Bytes()))
+
+	// The role is escaped so that the response stays valid JSON
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", exchangeTestToken(subjectToken, "user a\"b"))
+	assert.Equal(test, http.StatusBadRequest, response.Code)
+	assert.Equal(test, "The subject_token does not have the role a\"b", decodeTestMessage(test, response.Body.Bytes()))
+
+	// An exchanged token cannot be renewed into a token with all the roles again
+	response = serveTestRequest(identityService, http.MethodPost, "/token/renew", exchanged.AccessToken, nil)
+	assert.Equal(test, http.StatusUnauthorized, response.Code)
+}
+
+func TestExchangedTokenIsOnlyAcceptedByItsAudience(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	subjectToken := loginTestAccount(test, identityService, "administrator@example.com")
+
+	for audience, status := range map[string]int{"billing": http.StatusUnauthorized, "identity-provider": http.StatusOK} {
+		response := serveTestRequest(identityService, http.MethodPost, "/token", "", exchangeTestTokenForAudience(subjectToken, "administrator", audience))
+		assert.Equal(test, http.StatusOK, response.Code)
+
+		exchanged := tokenExchangeResponse{}
+		err := json.Unmarshal(response.Body.Bytes(), &exchanged)
+		assert.NoError(test, err)
+		assert.Contains(test, decodeTestToken(test, identityService, exchanged.AccessToken)["permissions"], "account:read")
+
+		response = serveTestRequest(identityService, http.MethodGet, "/account", exchanged.AccessToken, nil)
+		assert.Equal(test, status, response.Code, audience)
+	}
+}
+
+func TestTokenExchangeExpiresWithTheSubjectToken(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	createTestAccount(test, identityService, entity.Account{Email: "user@example.com", Roles: []string{"user"}})
+	subjectToken := loginTestAccount(test, identityService, "user@example.com")
+	subjectExpiresAt := decodeTestToken(test, identityService, subjectToken)["exp"].(float64)
+
+	identityService.TokenExchangeLifetime = time.Minute
+	response := serveTestRequest(identityService, http.MethodPost, "/token", "", exchangeTestToken(subjectToken, "user"))
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	exchanged := tokenExchangeResponse{}
+	err := json.Unmarshal(response.Body.Bytes(), &exchanged)
+	assert.NoError(test, err)
+	assert.True(test, exchanged.ExpiresIn <= 60)
+	assert.True(test, decodeTestToken(test, identityService, exchanged.AccessToken)["exp"].(float64) < subjectExpiresAt)
+
+	identityService.TokenExchangeLifetime = 24 * time.Hour
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", exchangeTestToken(subjectToken, "user"))
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	err = json.Unmarshal(response.Body.Bytes(), &exchanged)
+	assert.NoError(test, err)
+	assert.Equal(test, subjectExpiresAt, decodeTestToken(test, identityService, exchanged.AccessToken)["exp"].(float64))
+}
+
+func TestTokenExchangeRejectsTokensThatCannotBeExchanged(test *testing.T) {
+	identityService, cleanup := newTestService(test)
+	defer cleanup()
+
+	administrator := createTestAccount(test, identityService, entity.Account{Email: "administrator@example.com", Roles: []string{"user", "administrator"}})
+	user := createTestAccount(test, identityService, entity.Account{Email: "user@example.com", Roles: []string{"user"}})
+	administratorToken := loginTestAccount(test, identityService, administrator.Email)
+	userToken := loginTestAccount(test, identityService, user.Email)
+
+	response := serveTestRequest(identityService, http.MethodPost, "/token", "", exchangeTestToken("not-a-token", "user"))
+	assert.Equal(test, http.StatusBadRequest, response.Code)
+
+	// A revoked impersonation token
+	response = serveTestRequest(identityService, http.MethodPost, "/account/"+user.ID+"/impersonate", administratorToken, map[string]string{"reason": "Support case"})
+	assert.Equal(test, http.StatusCreated, response.Code)
+
+	var impersonation struct {
+		Token         string               `json:"token"`
+		Impersonation entity.Impersonation `json:"impersonation"`
+	}
+	err := json.Unmarshal(response.Body.Bytes(), &impersonation)
+	assert.NoError(test, err)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", exchangeTestToken(impersonation.Token, "user"))
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodDelete, "/impersonation/"+impersonation.Impersonation.ID, administratorToken, nil)
+	assert.Equal(test, http.StatusOK, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", exchangeTestToken(impersonation.Token, "user"))
+	assert.Equal(test, http.StatusBadRequest, response.Code)
+
+	// A token of an account that has since been required to change its password, and the password change token that it gets instead
+	err = identityService.DatabaseConnection.Model(&user).UpdateColumn("must_change_password", true).Error
+	assert.NoError(test, err)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", exchangeTestToken(userToken, "user"))
+	assert.Equal(test, http.StatusForbidden, response.Code)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", map[string]string{"email": user.Email, "password": testPassword})
+	assert.Equal(test, http.StatusCreated, response.Code)
+
+	var passwordChange struct {
+		Token                  string `json:"token"`
+		PasswordChangeRequired bool   `json:"passwordChangeRequired"`
+	}
+	err = json.Unmarshal(response.Body.Bytes(), &passwordChange)
+	assert.NoError(test, err)
+	assert.True(test, passwordChange.PasswordChangeRequired)
+
+	response = serveTestRequest(identityService, http.MethodPost, "/token", "", exchangeTestToken(passwordChange.Token, ""))
+	assert.Equal(test, http.StatusBadRequest, response.Code)
+}